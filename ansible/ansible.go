@@ -3,11 +3,34 @@ package ansible
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 
 	mapset "github.com/deckarep/golang-set/v2"
 )
 
+// hostLabelRe matches a single label of a DNS host name
+var hostLabelRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidHostName reports whether name is a valid DNS host name: dot separated
+// labels of letters, digits and inner hyphens. Host names come from guest
+// names and guest agents, so they are checked before being written into
+// config files such as the ssh config.
+func ValidHostName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostLabelRe.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetHosts returns a sorted list of hosts
 func (i *Inventory) GetHosts(hosts MapHostVar, excludedHosts mapset.Set[string]) []string {
 
@@ -28,6 +51,75 @@ func (i *Inventory) GetHosts(hosts MapHostVar, excludedHosts mapset.Set[string])
 	return keys
 }
 
+// HostNames returns the sorted list of hosts that are members of any group
+func (i *Inventory) HostNames() []string {
+
+	// Collect the hosts of every group
+	hosts := mapset.NewSet[string]()
+	for _, group := range i.Groups {
+		hosts.Append(group.Hosts...)
+	}
+
+	// Sort the list of hosts
+	keys := hosts.ToSlice()
+	sort.Strings(keys)
+
+	// Return the list of sorted hosts
+	return keys
+}
+
+// MergedVars returns the variables of a host merged the way Ansible does:
+// the vars of the all group, then the vars of each group the host belongs to
+// in alphabetical order, then the host's own variables.
+func (i *Inventory) MergedVars(host string) HostVars {
+
+	// Start with the vars of the all group
+	vars := HostVars{}
+	for k, v := range i.All.Vars {
+		vars[k] = v
+	}
+
+	// Apply the vars of each group the host belongs to
+	names := []string{}
+	for name := range i.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		group := i.Groups[name]
+		if !slices.Contains(group.Hosts, host) {
+			continue
+		}
+		for k, v := range group.Vars {
+			vars[k] = v
+		}
+	}
+
+	// Apply the host vars
+	for k, v := range i.Meta.HostVars[host] {
+		vars[k] = v
+	}
+
+	return vars
+}
+
+// Degraded reports whether nodes or guests were left out of the inventory
+func (i *Inventory) Degraded() bool {
+	return len(i.Meta.Diagnostics) > 0
+}
+
+// MissingNodes returns the nodes whose guests were left out of the
+// inventory, as opposed to single guests dropped by a hostname collision
+func (i *Inventory) MissingNodes() []string {
+	nodes := []string{}
+	for _, d := range i.Meta.Diagnostics {
+		if d.Vmid == 0 && !slices.Contains(nodes, d.Node) {
+			nodes = append(nodes, d.Node)
+		}
+	}
+	return nodes
+}
+
 // MarshalJSON implements the json.Marshaler interface for Item
 func (i Inventory) MarshalJSON() ([]byte, error) {
 	// 1. Marshal the struct fields (excluding Metadata due to `json:"-"` tag)
@@ -71,3 +163,35 @@ func (i Inventory) MarshalJSON() ([]byte, error) {
 	}
 	return msg1, nil
 }
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Inventory,
+// reading every top-level key other than "_meta" and "all" as a group.
+func (i *Inventory) UnmarshalJSON(data []byte) error {
+
+	// Decode the top-level keys
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	// Decode the metadata, the all group and the other groups
+	i.Groups = make(InventoryGroupMap)
+	for key, value := range raw {
+		var err error
+		switch key {
+		case "_meta":
+			err = json.Unmarshal(value, &i.Meta)
+		case "all":
+			err = json.Unmarshal(value, &i.All)
+		default:
+			group := InventoryGroup{}
+			err = json.Unmarshal(value, &group)
+			i.Groups[key] = group
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
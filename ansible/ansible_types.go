@@ -10,20 +10,34 @@ type Inventory struct {
 
 // InventoryMeta is the metadata for the Ansible inventory
 type InventoryMeta struct {
-	HostVars MapHostVar `json:"hostvars"`
+	HostVars    MapHostVar   `json:"hostvars"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Diagnostic records a node or guest that was left out of the inventory
+type Diagnostic struct {
+	Node  string `json:"node"`
+	Vmid  int    `json:"vmid,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
 }
 
 // MapHostVar is a map of ansible host variables
-type MapHostVar map[string]map[string]string
+type MapHostVar map[string]HostVars
+
+// HostVars is the set of variables for a single host
+type HostVars map[string]any
 
 // InventoryAll is the "all" group in the Ansible inventory
 type InventoryAll struct {
 	Children []string `json:"children"`
+	Vars     HostVars `json:"vars,omitempty"`
 }
 
 // InventoryGroup is a single Ansible inventory group
 type InventoryGroup struct {
 	Hosts []string `json:"hosts"`
+	Vars  HostVars `json:"vars,omitempty"`
 }
 
 // InventoryGroupMap is a map of inventory groups to their hosts
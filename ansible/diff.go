@@ -0,0 +1,175 @@
+// Package ansible contains the types and methods for implementing the Ansible inventory
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// InventoryDiff is the difference between two inventories
+type InventoryDiff struct {
+	AddedHosts     []HostGroups    `json:"added_hosts"`
+	RemovedHosts   []HostGroups    `json:"removed_hosts"`
+	GroupChanges   []GroupChange   `json:"group_changes"`
+	HostVarChanges []HostVarChange `json:"hostvar_changes"`
+}
+
+// HostGroups is a host and the groups it is a member of
+type HostGroups struct {
+	Host   string   `json:"host"`
+	Groups []string `json:"groups"`
+}
+
+// GroupChange is a change of the group memberships of a host
+type GroupChange struct {
+	Host    string   `json:"host"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// HostVarChange is a change of a single host variable. Old is nil for added
+// variables and New is nil for removed variables.
+type HostVarChange struct {
+	Host string `json:"host"`
+	Var  string `json:"var"`
+	Old  any    `json:"old"`
+	New  any    `json:"new"`
+}
+
+// Diff returns the hosts added and removed between the old and new
+// inventories, and for hosts present in both the changes of their group
+// memberships and host variables.
+func Diff(old *Inventory, new *Inventory) *InventoryDiff {
+
+	d := &InventoryDiff{
+		AddedHosts:     []HostGroups{},
+		RemovedHosts:   []HostGroups{},
+		GroupChanges:   []GroupChange{},
+		HostVarChanges: []HostVarChange{},
+	}
+
+	oldHosts := old.HostNames()
+	newHosts := new.HostNames()
+
+	for _, host := range newHosts {
+		if !slices.Contains(oldHosts, host) {
+			d.AddedHosts = append(d.AddedHosts, HostGroups{Host: host, Groups: new.HostGroups(host)})
+		}
+	}
+
+	for _, host := range oldHosts {
+		if !slices.Contains(newHosts, host) {
+			d.RemovedHosts = append(d.RemovedHosts, HostGroups{Host: host, Groups: old.HostGroups(host)})
+			continue
+		}
+
+		// Compare the group memberships
+		oldGroups := old.HostGroups(host)
+		newGroups := new.HostGroups(host)
+		change := GroupChange{Host: host}
+		for _, group := range newGroups {
+			if !slices.Contains(oldGroups, group) {
+				change.Added = append(change.Added, group)
+			}
+		}
+		for _, group := range oldGroups {
+			if !slices.Contains(newGroups, group) {
+				change.Removed = append(change.Removed, group)
+			}
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			d.GroupChanges = append(d.GroupChanges, change)
+		}
+
+		// Compare the host variables
+		d.HostVarChanges = append(d.HostVarChanges, diffHostVars(host, old.Meta.HostVars[host], new.Meta.HostVars[host])...)
+	}
+
+	return d
+}
+
+// HostGroups returns the sorted list of groups host is a member of
+func (i *Inventory) HostGroups(host string) []string {
+	groups := []string{}
+	for name, group := range i.Groups {
+		if slices.Contains(group.Hosts, host) {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Empty reports whether the inventories were identical
+func (d *InventoryDiff) Empty() bool {
+	return len(d.AddedHosts) == 0 && len(d.RemovedHosts) == 0 && len(d.GroupChanges) == 0 && len(d.HostVarChanges) == 0
+}
+
+// String returns a human readable summary of the diff with one line per
+// change: "+" for added hosts, "-" for removed hosts and "~" for changed
+// hosts.
+func (d *InventoryDiff) String() string {
+	var b strings.Builder
+	for _, h := range d.AddedHosts {
+		fmt.Fprintf(&b, "+ %s (%s)\n", h.Host, strings.Join(h.Groups, ", "))
+	}
+	for _, h := range d.RemovedHosts {
+		fmt.Fprintf(&b, "- %s (%s)\n", h.Host, strings.Join(h.Groups, ", "))
+	}
+	for _, c := range d.GroupChanges {
+		changes := []string{}
+		for _, group := range c.Added {
+			changes = append(changes, "+"+group)
+		}
+		for _, group := range c.Removed {
+			changes = append(changes, "-"+group)
+		}
+		fmt.Fprintf(&b, "~ %s groups: %s\n", c.Host, strings.Join(changes, " "))
+	}
+	for _, c := range d.HostVarChanges {
+		fmt.Fprintf(&b, "~ %s %s: %s -> %s\n", c.Host, c.Var, jsonString(c.Old), jsonString(c.New))
+	}
+	return b.String()
+}
+
+// diffHostVars returns the changed variables of a host, sorted by name.
+// Values are compared by their JSON encoding, so a snapshot read back from
+// JSON compares equal to the inventory it was written from.
+func diffHostVars(host string, old HostVars, new HostVars) []HostVarChange {
+
+	keys := []string{}
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, exists := old[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []HostVarChange{}
+	for _, k := range keys {
+		oldValue, newValue := old[k], new[k]
+		oldJSON, _ := json.Marshal(oldValue)
+		newJSON, _ := json.Marshal(newValue)
+		if !bytes.Equal(oldJSON, newJSON) {
+			changes = append(changes, HostVarChange{Host: host, Var: k, Old: oldValue, New: newValue})
+		}
+	}
+
+	return changes
+}
+
+// jsonString formats a value as JSON for display
+func jsonString(v any) string {
+	str, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(str)
+}
@@ -1,7 +1,30 @@
 // Package config contains the configuration types for proxmox-ansible-inventory
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// AddressFamilies are the valid values for proxmox.address_family
+var AddressFamilies = []string{"ipv4", "ipv6", "prefer_ipv4", "prefer_ipv6"}
+
+// HostnameSources are the valid values for proxmox.hostname.sources
+var HostnameSources = []string{"name", "hostname", "agent"}
+
+// TemplateFacts are the guest facts available in hostname templates
+var TemplateFacts = []string{"domain", "name", "node", "pool", "type", "vmid"}
+
+// TemplateRe matches a {{fact}} placeholder in a hostname template
+var TemplateRe = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// LookupSources are the valid values for proxmox.lookup_order
+var LookupSources = []string{"agent", "cloudinit", "dns"}
+
+// ErrorPolicies are the valid values for proxmox.on_error
+var ErrorPolicies = []string{"fail_fast", "skip_node", "skip_with_warning"}
 
 // CheckRequiredValues checks for required values in the config file
 func (p *Params) CheckRequiredValues () error {
@@ -21,6 +44,58 @@ func (p *Params) CheckRequiredValues () error {
 	if p.Proxmox.API.URL == "" {
 		return errors.New("proxmox.api.url is required")
 	}
+
+	if !slices.Contains(AddressFamilies, p.Proxmox.AddressFamily) {
+		return errors.New("proxmox.address_family must be one of ipv4, ipv6, prefer_ipv4 or prefer_ipv6")
+	}
+
+	for _, source := range p.Proxmox.Hostname.Sources {
+		if !slices.Contains(HostnameSources, source) {
+			return fmt.Errorf("proxmox.hostname.sources: unknown source %q (must be name, hostname or agent)", source)
+		}
+	}
+
+	if err := checkTemplate("proxmox.hostname.template", p.Proxmox.Hostname.Template); err != nil {
+		return err
+	}
+
+	for tag, tmpl := range p.Proxmox.Hostname.TagTemplates {
+		if err := checkTemplate("proxmox.hostname.tag_templates."+tag, tmpl); err != nil {
+			return err
+		}
+	}
+
+	for _, hook := range p.Webhooks {
+		if hook.URL == "" {
+			return errors.New("webhooks: url is required")
+		}
+		if !slices.Contains([]string{"", "json", "slack"}, hook.Type) {
+			return fmt.Errorf("webhooks: unknown type %q for %s (must be json or slack)", hook.Type, hook.URL)
+		}
+		if hook.Retries < 0 {
+			return fmt.Errorf("webhooks: retries must not be negative for %s", hook.URL)
+		}
+	}
+
+	for _, source := range p.Proxmox.LookupOrder {
+		if !slices.Contains(LookupSources, source) {
+			return fmt.Errorf("proxmox.lookup_order: unknown source %q (must be agent, cloudinit or dns)", source)
+		}
+	}
+
+	if !slices.Contains(ErrorPolicies, p.Proxmox.OnError) {
+		return errors.New("proxmox.on_error must be one of fail_fast, skip_node or skip_with_warning")
+	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// checkTemplate checks that a hostname template only references known facts
+func checkTemplate(key string, tmpl string) error {
+	for _, m := range TemplateRe.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(TemplateFacts, m[1]) {
+			return fmt.Errorf("%s: unknown fact %q (must be one of domain, name, node, pool, type or vmid)", key, m[1])
+		}
+	}
+	return nil
+}
@@ -1,27 +1,51 @@
 // Package config contains the configuration types for proxmox-ansible-inventory
 package config
 
+import "time"
+
 // Params is the configuration info used by proxmox-ansible-inventory
 type Params struct {
-	Proxmox ProxmoxParams `mapstructure:"proxmox"`
+	Prometheus PrometheusParams `mapstructure:"prometheus"`
+	Proxmox    ProxmoxParams    `mapstructure:"proxmox"`
+	Watch      WatchParams      `mapstructure:"watch"`
+	Webhooks   []WebhookParams  `mapstructure:"webhooks"`
+	Zone       ZoneParams       `mapstructure:"zone"`
 }
 
 // ProxmoxParams is the Proxmox section of the config file
 type ProxmoxParams struct {
+	// AddressFamily selects the ansible_host address: "ipv4", "ipv6", "prefer_ipv4" or "prefer_ipv6"
+	AddressFamily string `mapstructure:"address_family"`
 	// APIParams is the Proxmox API token
 	API APIParams `mapstructure:"api"`
+	// DNS configures resolution and verification of the generated hostnames
+	DNS DNSParams `mapstructure:"dns"`
 	// Domain is appended to short hostnames (e.g. "example.com" turns "host1" into "host1.example.com")
 	Domain string `mapstructure:"domain"`
 	// Exclude is a list of hostnames to exclude from the inventory
 	Exclude []string `mapstructure:"exclude"`
+	// Facts selects the additional guest facts added as host variables
+	Facts FactsParams `mapstructure:"facts"`
+	// GroupVars are variables added to inventory groups, keyed by group name ("all" for every host)
+	GroupVars map[string]map[string]any `mapstructure:"group_vars"`
+	// Hostname configures how inventory hostnames are derived from guests
+	Hostname HostnameParams `mapstructure:"hostname"`
 	// Lookup enables additional API calls to resolve ansible_host IP addresses
 	Lookup bool `mapstructure:"lookup"`
+	// LookupOrder is the ordered list of address sources tried for VMs: "agent", "cloudinit" and "dns"
+	LookupOrder []string `mapstructure:"lookup_order"`
+	// OnError is the policy for nodes that fail to list their guests: "fail_fast", "skip_node" or "skip_with_warning"
+	OnError string `mapstructure:"on_error"`
+	// Timeout is the deadline for building the inventory, zero for no deadline
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 // APIParams is the api_token section of the config file
 type APIParams struct {
 	// Secret is the api token secret
 	Secret string `mapstructure:"secret"`
+	// Timeout is the deadline for a single API request
+	Timeout time.Duration `mapstructure:"timeout"`
 	// TLSInsecure skips TLS certificate verification (for self-signed certs)
 	TLSInsecure bool `mapstructure:"tls_insecure"`
 	// Token is the api token
@@ -31,3 +55,95 @@ type APIParams struct {
 	// User is the api token user
 	User   string `mapstructure:"user"`
 }
+
+// DNSParams is the dns section of the config file
+type DNSParams struct {
+	// Resolve resolves every hostname and uses the answer as ansible_host when no address was found through the API
+	Resolve bool `mapstructure:"resolve"`
+	// Server is the DNS server to query (e.g. "10.0.0.53" or "10.0.0.53:5353"), the system resolver is used if empty
+	Server string `mapstructure:"server"`
+	// Verify flags hosts whose DNS record does not match the address reported by Proxmox
+	Verify bool `mapstructure:"verify"`
+}
+
+// FactsParams is the facts section of the config file
+type FactsParams struct {
+	// Disks adds proxmox_disks, the disks and mount points of each guest
+	Disks bool `mapstructure:"disks"`
+	// GuestOS adds the operating system, kernel, host name and time zone
+	// reported by the QEMU guest agent of each VM, and os_<id> groups
+	GuestOS bool `mapstructure:"guest_os"`
+	// Interfaces adds proxmox_interfaces, the network devices of each guest
+	Interfaces bool `mapstructure:"interfaces"`
+	// StorageGroups adds each guest to a proxmox_storage_<storage> group for
+	// every storage its disks are on
+	StorageGroups bool `mapstructure:"storage_groups"`
+}
+
+// HostnameParams is the hostname section of the config file
+type HostnameParams struct {
+	// Lowercase converts hostnames to lower case
+	Lowercase bool `mapstructure:"lowercase"`
+	// Normalize replaces characters that are not valid in a DNS name with "-"
+	Normalize bool `mapstructure:"normalize"`
+	// Sources is the ordered list of hostname sources: "name", "hostname" (LXC) and "agent" (QEMU guest agent)
+	Sources []string `mapstructure:"sources"`
+	// TagTemplates overrides Template for guests with the given tag
+	TagTemplates map[string]string `mapstructure:"tag_templates"`
+	// Template formats the inventory hostname from guest facts (e.g. "{{name}}-{{vmid}}.{{node}}.{{domain}}")
+	Template string `mapstructure:"template"`
+}
+
+// PrometheusParams is the prometheus section of the config file
+type PrometheusParams struct {
+	// DefaultPorts are the ports scraped on every host (e.g. 9100 for node_exporter)
+	DefaultPorts []int `mapstructure:"default_ports"`
+	// Ports maps a Proxmox tag to the ports scraped on hosts with that tag (e.g. postgres: [9187])
+	Ports map[string][]int `mapstructure:"ports"`
+}
+
+// WatchParams is the watch section of the config file
+type WatchParams struct {
+	// Hook is a shell command run after output files changed
+	Hook string `mapstructure:"hook"`
+	// Interval is how often the cluster resources are polled for changes
+	Interval time.Duration `mapstructure:"interval"`
+	// Outputs are the files rewritten when the inventory changes
+	Outputs []OutputParams `mapstructure:"outputs"`
+	// RebuildInterval forces a full rebuild to pick up changes not visible in the cluster resources, such as IP addresses
+	RebuildInterval time.Duration `mapstructure:"rebuild_interval"`
+}
+
+// OutputParams is a single output file of the watch section
+type OutputParams struct {
+	// Format is the output format (e.g. "json", "yaml", "ssh-config" or "file_sd")
+	Format string `mapstructure:"format"`
+	// Path is the file the output is written to
+	Path string `mapstructure:"path"`
+}
+
+// WebhookParams is a single entry of the webhooks section of the config file
+type WebhookParams struct {
+	// Retries is the number of times a failed request is retried
+	Retries int `mapstructure:"retries"`
+	// Secret signs the payload with HMAC-SHA256 in the X-Signature-256 header
+	Secret string `mapstructure:"secret"`
+	// Type is the payload type: "json" or "slack"
+	Type string `mapstructure:"type"`
+	// URL is the webhook endpoint
+	URL string `mapstructure:"url"`
+}
+
+// ZoneParams is the zone section of the config file
+type ZoneParams struct {
+	// Hostmaster is the SOA contact mailbox, "hostmaster.<domain>." if empty
+	Hostmaster string `mapstructure:"hostmaster"`
+	// Nameservers are the NS records of the zone, the first one is the SOA primary ("localhost." if empty)
+	Nameservers []string `mapstructure:"nameservers"`
+	// Reverse is the network of the reverse-zone output, e.g. "10.0.0.0/24"
+	Reverse string `mapstructure:"reverse"`
+	// Serial is the initial SOA serial
+	Serial uint32 `mapstructure:"serial"`
+	// TTL is the default record TTL in seconds
+	TTL int `mapstructure:"ttl"`
+}
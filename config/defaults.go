@@ -0,0 +1,28 @@
+// Package config contains the configuration types for proxmox-ansible-inventory
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SetDefaults sets the default values of the config file keys on v. Call it
+// before unmarshalling into Params, as CheckRequiredValues rejects the empty
+// values of keys such as proxmox.address_family and proxmox.on_error.
+func SetDefaults(v *viper.Viper) {
+	v.SetDefault("proxmox.address_family", "prefer_ipv4")
+	v.SetDefault("proxmox.api.timeout", 30*time.Second)
+	v.SetDefault("proxmox.domain", "")
+	v.SetDefault("proxmox.facts.disks", false)
+	v.SetDefault("proxmox.facts.guest_os", false)
+	v.SetDefault("proxmox.facts.interfaces", false)
+	v.SetDefault("proxmox.facts.storage_groups", false)
+	v.SetDefault("proxmox.hostname.sources", []string{"name"})
+	v.SetDefault("proxmox.lookup", false)
+	v.SetDefault("proxmox.lookup_order", []string{"agent", "cloudinit"})
+	v.SetDefault("proxmox.on_error", "fail_fast")
+	v.SetDefault("proxmox.timeout", 0)
+	v.SetDefault("watch.interval", 30*time.Second)
+	v.SetDefault("watch.rebuild_interval", 10*time.Minute)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/output"
+)
+
+// runDiff compares the current inventory with the snapshot in
+// snapshotFlag, prints the differences and optionally saves the current
+// inventory as the new snapshot. It reports whether anything changed.
+func runDiff(ctx context.Context, b *inventory.Builder) (bool, error) {
+
+	if snapshotFlag == "" {
+		return false, errors.New("diff requires --snapshot")
+	}
+
+	// Read the snapshot, a missing snapshot is treated as an empty inventory
+	old := &ansible.Inventory{}
+	data, err := os.ReadFile(snapshotFlag)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return false, err
+	default:
+		if err := json.Unmarshal(data, old); err != nil {
+			return false, fmt.Errorf("error reading snapshot %s: %w", snapshotFlag, err)
+		}
+	}
+
+	// Build the current inventory
+	inv, err := b.Build(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Print the differences
+	d := ansible.Diff(old, inv)
+	switch diffFormatFlag {
+	case "json":
+		str, err := json.MarshalIndent(d, "", "   ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("%s\n", str)
+	case "text":
+		fmt.Print(d.String())
+	default:
+		return false, fmt.Errorf("unknown diff format %q (must be text or json)", diffFormatFlag)
+	}
+
+	// Save the current inventory as the new snapshot
+	if saveFlag {
+		str, err := output.JSON(inv)
+		if err != nil {
+			return false, err
+		}
+		if err := output.WriteFile(snapshotFlag, str); err != nil {
+			return false, err
+		}
+	}
+
+	return !d.Empty(), nil
+}
@@ -0,0 +1,312 @@
+// Package inventory builds the Ansible inventory of a Proxmox cluster
+package inventory
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// lxcConfig returns the config of an LXC container, fetching it on first use
+func (b *Builder) lxcConfig(ctx context.Context, g *Guest) (*proxmox.LxcConfigData, error) {
+	if g.lxcConfig == nil && g.configErr == nil {
+		cfg, err := b.API.GetLxcConfig(ctx, g.Node, g.Vmid)
+		if err != nil {
+			g.configErr = err
+		} else {
+			g.lxcConfig = &cfg.Data
+		}
+	}
+	return g.lxcConfig, g.configErr
+}
+
+// vmConfig returns the config of a QEMU VM, fetching it on first use
+func (b *Builder) vmConfig(ctx context.Context, g *Guest) (*proxmox.VMConfigData, error) {
+	if g.vmConfig == nil && g.configErr == nil {
+		cfg, err := b.API.GetVMConfig(ctx, g.Node, g.Vmid)
+		if err != nil {
+			g.configErr = err
+		} else {
+			g.vmConfig = &cfg.Data
+		}
+	}
+	return g.vmConfig, g.configErr
+}
+
+// agentNetwork returns the interfaces reported by the QEMU guest agent of a
+// VM, asking the agent on first use
+func (b *Builder) agentNetwork(ctx context.Context, g *Guest) ([]proxmox.QemuAgentNetworkResult, error) {
+	if g.agentNetwork == nil && g.agentErr == nil {
+		resp, err := b.API.GetQemuNetworkConfig(ctx, g.Node, g.Vmid)
+		if err != nil {
+			g.agentErr = err
+		} else {
+			g.agentNetwork = &resp.Data
+		}
+	}
+	if g.agentErr != nil {
+		return nil, g.agentErr
+	}
+	return g.agentNetwork.Result, nil
+}
+
+// guestDisk is a disk or mount point of a guest
+type guestDisk struct {
+	proxmox.Disk
+	// Bus is the bus of a QEMU disk, e.g. "scsi", empty for LXC containers
+	Bus string
+	// Device is the config key of the disk, e.g. "scsi0", "rootfs" or "mp0"
+	Device string
+}
+
+// collectFacts adds the guest facts enabled in proxmox.facts to the host
+// variables of a guest, and the guest to its os_<id> and
+// proxmox_storage_<storage> groups.
+func (b *Builder) collectFacts(ctx context.Context, hostVarMap ansible.MapHostVar, roles map[string][]string, g *Guest) {
+
+	facts := b.Config.Proxmox.Facts
+	if facts.GuestOS && g.Type == "qemu" {
+		if group := b.setGuestOSFacts(ctx, hostVarMap, g); group != "" {
+			roles[group] = append(roles[group], g.Hostname)
+		}
+	}
+	if facts.Interfaces {
+		b.setInterfaceFacts(ctx, hostVarMap, g)
+	}
+	if !facts.Disks && !facts.StorageGroups {
+		return
+	}
+
+	disks, err := b.guestDisks(ctx, g)
+	if err != nil {
+		slog.Warn("failed to collect disk facts", "host", g.Hostname, "error", err)
+		return
+	}
+	if facts.Disks {
+		b.setDiskFacts(hostVarMap, g, disks)
+	}
+	if facts.StorageGroups {
+		for _, disk := range disks {
+			if disk.Storage == "" {
+				continue
+			}
+			group := "proxmox_storage_" + SanitizeGroupName(disk.Storage)
+			if !slices.Contains(roles[group], g.Hostname) {
+				roles[group] = append(roles[group], g.Hostname)
+			}
+		}
+	}
+}
+
+// guestDisks returns the disks of a QEMU VM or the rootfs and mount points
+// of an LXC container. CD-ROM drives are left out.
+func (b *Builder) guestDisks(ctx context.Context, g *Guest) ([]guestDisk, error) {
+
+	disks := []guestDisk{}
+	if g.Type == "lxc" {
+		cfg, err := b.lxcConfig(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Rootfs != "" {
+			rootfs := proxmox.ParseDisk(cfg.Rootfs)
+			rootfs.MountPoint = "/"
+			disks = append(disks, guestDisk{Disk: rootfs, Device: "rootfs"})
+		}
+		for _, i := range proxmox.Indexes(cfg.Mp) {
+			disks = append(disks, guestDisk{Disk: proxmox.ParseMountPoint(cfg.Mp[i]), Device: "mp" + strconv.Itoa(i)})
+		}
+		return disks, nil
+	}
+
+	cfg, err := b.vmConfig(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	buses := []struct {
+		name  string
+		disks map[int]string
+	}{{"ide", cfg.Ide}, {"sata", cfg.Sata}, {"scsi", cfg.Scsi}, {"virtio", cfg.Virtio}}
+	for _, bus := range buses {
+		for _, i := range proxmox.Indexes(bus.disks) {
+			disk := proxmox.ParseDisk(bus.disks[i])
+			if disk.Media == "cdrom" {
+				continue
+			}
+			disks = append(disks, guestDisk{Disk: disk, Bus: bus.name, Device: bus.name + strconv.Itoa(i)})
+		}
+	}
+	return disks, nil
+}
+
+// setDiskFacts adds proxmox_disks, the disks of a guest, to its host variables
+func (b *Builder) setDiskFacts(hostVarMap ansible.MapHostVar, g *Guest, disks []guestDisk) {
+
+	facts := []map[string]any{}
+	for _, disk := range disks {
+		fact := map[string]any{
+			"backup":     disk.Backup,
+			"bus":        disk.Bus,
+			"device":     disk.Device,
+			"format":     disk.Format,
+			"size":       disk.Size,
+			"size_bytes": disk.SizeBytes,
+			"storage":    disk.Storage,
+			"volume":     disk.Volume,
+		}
+		if g.Type == "lxc" {
+			fact["mount_point"] = disk.MountPoint
+		} else {
+			fact["discard"] = disk.Discard
+			fact["ssd"] = disk.SSD
+		}
+		facts = append(facts, fact)
+	}
+
+	vars, ok := hostVarMap[g.Hostname]
+	if !ok {
+		vars = ansible.HostVars{}
+		hostVarMap[g.Hostname] = vars
+	}
+	vars["proxmox_disks"] = facts
+}
+
+// agentHostName returns the host name reported by the QEMU guest agent of a
+// VM, asking the agent on first use
+func (b *Builder) agentHostName(ctx context.Context, g *Guest) (string, error) {
+	if g.agentHost == nil && g.agentHostErr == nil {
+		resp, err := b.API.GetQemuAgentHostName(ctx, g.Node, g.Vmid)
+		if err != nil {
+			g.agentHostErr = err
+		} else {
+			g.agentHost = &resp.Data.Result
+		}
+	}
+	if g.agentHostErr != nil {
+		return "", g.agentHostErr
+	}
+	return g.agentHost.HostName, nil
+}
+
+// setGuestOSFacts adds the operating system, kernel, host name and time zone
+// reported by the QEMU guest agent of a VM to its host variables, and returns
+// the os_<id> group of the VM, or "" if the agent did not answer.
+func (b *Builder) setGuestOSFacts(ctx context.Context, hostVarMap ansible.MapHostVar, g *Guest) string {
+
+	osInfo, err := b.API.GetQemuAgentOSInfo(ctx, g.Node, g.Vmid)
+	if err != nil {
+		slog.Debug("no OS facts from the guest agent", "host", g.Hostname, "error", err)
+		return ""
+	}
+	info := osInfo.Data.Result
+
+	vars, ok := hostVarMap[g.Hostname]
+	if !ok {
+		vars = ansible.HostVars{}
+		hostVarMap[g.Hostname] = vars
+	}
+	vars["proxmox_guest_os_id"] = info.ID
+	vars["proxmox_guest_os_name"] = info.PrettyName
+	vars["proxmox_guest_os_version"] = info.VersionID
+	if info.VersionID == "" {
+		vars["proxmox_guest_os_version"] = info.Version
+	}
+	vars["proxmox_guest_kernel"] = info.KernelRelease
+
+	// The host name and time zone are optional, older agents lack them
+	if host, err := b.agentHostName(ctx, g); err == nil {
+		vars["proxmox_guest_hostname"] = host
+	}
+	if tz, err := b.API.GetQemuAgentTimezone(ctx, g.Node, g.Vmid); err == nil {
+		vars["proxmox_guest_timezone"] = tz.Data.Result.Zone
+	}
+
+	// Windows reports itself as "mswindows"
+	id := info.ID
+	if id == "mswindows" {
+		id = "windows"
+	}
+	if id == "" {
+		return ""
+	}
+	return "os_" + SanitizeGroupName(id)
+}
+
+// setInterfaceFacts adds proxmox_interfaces, the netN devices of a guest, to
+// its host variables. The interface names of VMs come from the guest agent,
+// matched by MAC address, when the agent is in proxmox.lookup_order.
+func (b *Builder) setInterfaceFacts(ctx context.Context, hostVarMap ansible.MapHostVar, g *Guest) {
+
+	var nets, ipconfigs map[int]string
+	if g.Type == "lxc" {
+		cfg, err := b.lxcConfig(ctx, g)
+		if err != nil {
+			slog.Warn("failed to collect interface facts", "host", g.Hostname, "error", err)
+			return
+		}
+		nets = cfg.Net
+	} else {
+		cfg, err := b.vmConfig(ctx, g)
+		if err != nil {
+			slog.Warn("failed to collect interface facts", "host", g.Hostname, "error", err)
+			return
+		}
+		nets, ipconfigs = cfg.Net, cfg.Ipconfig
+	}
+
+	// Map MAC addresses to the interface names seen by the guest agent
+	agentNames := map[string]string{}
+	if g.Type == "qemu" && slices.Contains(b.Config.Proxmox.LookupOrder, "agent") {
+		results, err := b.agentNetwork(ctx, g)
+		if err != nil {
+			slog.Debug("no interface names from the guest agent", "host", g.Hostname, "error", err)
+		}
+		for _, iface := range results {
+			agentNames[strings.ToLower(iface.HardwareAddress)] = iface.Name
+		}
+	}
+
+	interfaces := []map[string]any{}
+	for _, i := range proxmox.Indexes(nets) {
+		dev := proxmox.ParseNetDevice(nets[i])
+
+		// Cloud-init settings of a VM apply to the device with the same index
+		if ipconfig, ok := ipconfigs[i]; ok {
+			ipcfg := proxmox.ParseNetDevice(ipconfig)
+			dev.IP, dev.IP6, dev.Gateway, dev.Gateway6 = ipcfg.IP, ipcfg.IP6, ipcfg.Gateway, ipcfg.Gateway6
+		}
+		if name, ok := agentNames[dev.MAC]; ok && dev.Name == "" {
+			dev.Name = name
+		}
+
+		var vlan any
+		if dev.Tag != 0 {
+			vlan = dev.Tag
+		}
+		interfaces = append(interfaces, map[string]any{
+			"bridge":   dev.Bridge,
+			"device":   "net" + strconv.Itoa(i),
+			"firewall": dev.Firewall,
+			"gw":       dev.Gateway,
+			"gw6":      dev.Gateway6,
+			"ip":       dev.IP,
+			"ip6":      dev.IP6,
+			"mac":      dev.MAC,
+			"model":    dev.Model,
+			"name":     dev.Name,
+			"vlan":     vlan,
+		})
+	}
+
+	vars, ok := hostVarMap[g.Hostname]
+	if !ok {
+		vars = ansible.HostVars{}
+		hostVarMap[g.Hostname] = vars
+	}
+	vars["proxmox_interfaces"] = interfaces
+}
@@ -0,0 +1,239 @@
+// Package inventory builds the Ansible inventory of a Proxmox cluster
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// Guest is a running Proxmox guest selected for the inventory
+type Guest struct {
+	// CPUs is the number of virtual CPUs
+	CPUs int
+	// Hostname is the inventory hostname
+	Hostname string
+	// Maxdisk is the size of the root disk in bytes
+	Maxdisk int64
+	// Maxmem is the memory size in bytes
+	Maxmem int64
+	// Name is the Proxmox guest name
+	Name string
+	// Node is the Proxmox node the guest runs on
+	Node string
+	// Pool is the Proxmox resource pool of the guest
+	Pool string
+	// Status is the guest status, e.g. "running"
+	Status string
+	// Tags are the Proxmox tags of the guest
+	Tags []string
+	// Type is the guest type, "lxc" or "qemu"
+	Type string
+	// Uptime is the guest uptime in seconds
+	Uptime int
+	// Vmid is the Proxmox guest ID
+	Vmid int
+
+	// The API responses about the guest, fetched at most once per build
+	lxcConfig    *proxmox.LxcConfigData
+	vmConfig     *proxmox.VMConfigData
+	configErr    error
+	agentNetwork *proxmox.QemuAgentNetworkData
+	agentErr     error
+	agentHost    *proxmox.QemuAgentHostName
+	agentHostErr error
+}
+
+// splitTags splits a Proxmox tag list such as "web;prod" into its tags
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+}
+
+// guestHostVars returns the host variables describing a guest
+func guestHostVars(g *Guest) ansible.HostVars {
+	vars := ansible.HostVars{
+		"proxmox_name": g.Name,
+		"proxmox_node": g.Node,
+		"proxmox_tags": g.Tags,
+		"proxmox_type": g.Type,
+		"proxmox_vmid": g.Vmid,
+	}
+	if g.Pool != "" {
+		vars["proxmox_pool"] = g.Pool
+	}
+	return vars
+}
+
+var (
+	hostnameRe = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+	multiDotRe = regexp.MustCompile(`\.{2,}`)
+)
+
+// nameGuests sets the inventory hostname of each guest from the configured
+// hostname sources. Guests are processed in vmid order; when two guests end
+// up with the same hostname the collision is logged and the guest with the
+// higher vmid is left out of the inventory and returned as a diagnostic.
+func (b *Builder) nameGuests(ctx context.Context, guests []*Guest, excluded mapset.Set[string]) ([]*Guest, []ansible.Diagnostic) {
+
+	sort.SliceStable(guests, func(i, j int) bool {
+		return guests[i].Vmid < guests[j].Vmid
+	})
+
+	named := make([]*Guest, 0, len(guests))
+	skipped := []ansible.Diagnostic{}
+	seen := make(map[string]*Guest)
+	for _, g := range guests {
+		name := b.guestHostname(ctx, g)
+		if tmpl := b.guestTemplate(g); tmpl != "" {
+			g.Hostname = b.renderHostname(tmpl, g, name)
+		} else {
+			g.Hostname = b.fqdn(name)
+		}
+		if excluded.ContainsOne(g.Hostname) {
+			continue
+		}
+		if other, exists := seen[g.Hostname]; exists {
+			slog.Warn("hostname collision, skipping guest", "hostname", g.Hostname,
+				"type", g.Type, "vmid", g.Vmid, "node", g.Node,
+				"other_type", other.Type, "other_vmid", other.Vmid, "other_node", other.Node)
+			skipped = append(skipped, ansible.Diagnostic{
+				Node:  g.Node,
+				Vmid:  g.Vmid,
+				Name:  g.Name,
+				Error: fmt.Sprintf("hostname %s collides with %s %d on %s", g.Hostname, other.Type, other.Vmid, other.Node),
+			})
+			continue
+		}
+		seen[g.Hostname] = g
+		named = append(named, g)
+	}
+
+	return named, skipped
+}
+
+// guestHostname returns the first non-empty hostname from the sources in
+// proxmox.hostname.sources, falling back to the Proxmox guest name. Names from
+// the hostname and agent sources are controlled by the guest, so they are
+// skipped unless they are valid DNS names, whether or not normalization is
+// enabled.
+func (b *Builder) guestHostname(ctx context.Context, g *Guest) string {
+	for _, source := range b.Config.Proxmox.Hostname.Sources {
+		var name string
+		switch source {
+		case "name":
+			name = g.Name
+		case "hostname":
+			if g.Type != "lxc" {
+				continue
+			}
+			cfg, err := b.lxcConfig(ctx, g)
+			if err != nil {
+				slog.Debug("hostname source failed", "source", source, "vmid", g.Vmid, "error", err)
+				continue
+			}
+			name = cfg.Hostname
+		case "agent":
+			if g.Type != "qemu" {
+				continue
+			}
+			host, err := b.agentHostName(ctx, g)
+			if err != nil {
+				slog.Debug("hostname source failed", "source", source, "vmid", g.Vmid, "error", err)
+				continue
+			}
+			name = host
+		}
+		name = b.normalizeHostname(name)
+		if name == "" {
+			continue
+		}
+
+		// Names reported by the guest are only used if they are valid DNS names
+		if source != "name" && !ansible.ValidHostName(name) {
+			slog.Warn("ignoring invalid hostname", "source", source, "vmid", g.Vmid, "hostname", name)
+			continue
+		}
+		return name
+	}
+	return b.normalizeHostname(g.Name)
+}
+
+// normalizeHostname applies the configured lowercasing and character
+// normalization to a hostname. Normalization replaces each run of characters
+// that are not valid in a DNS name with "-" and trims leading and trailing
+// separators.
+func (b *Builder) normalizeHostname(name string) string {
+	if b.Config.Proxmox.Hostname.Lowercase {
+		name = strings.ToLower(name)
+	}
+	if b.Config.Proxmox.Hostname.Normalize {
+		name = hostnameRe.ReplaceAllString(name, "-")
+		name = strings.Trim(name, "-.")
+	}
+	return name
+}
+
+// guestTemplate returns the hostname template for a guest: the template of
+// its first tag listed in proxmox.hostname.tag_templates, otherwise
+// proxmox.hostname.template.
+func (b *Builder) guestTemplate(g *Guest) string {
+	for _, tag := range g.Tags {
+		if tmpl, ok := b.Config.Proxmox.Hostname.TagTemplates[strings.ToLower(tag)]; ok {
+			return tmpl
+		}
+	}
+	return b.Config.Proxmox.Hostname.Template
+}
+
+// renderHostname replaces the {{fact}} placeholders in tmpl with the facts of
+// a guest. Empty facts leave no empty labels behind, so "{{name}}.{{pool}}.lab"
+// renders as "web1.lab" for a guest without a pool. A name that already ends
+// with the configured domain, as reported by some guest agents, is shortened
+// so the domain is not repeated.
+func (b *Builder) renderHostname(tmpl string, g *Guest, name string) string {
+	domain := b.Config.Proxmox.Domain
+	if domain != "" {
+		name = strings.TrimSuffix(name, "."+domain)
+	}
+	facts := map[string]string{
+		"domain": domain,
+		"name":   name,
+		"node":   g.Node,
+		"pool":   g.Pool,
+		"type":   g.Type,
+		"vmid":   strconv.Itoa(g.Vmid),
+	}
+	hostname := config.TemplateRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		return facts[config.TemplateRe.FindStringSubmatch(m)[1]]
+	})
+	hostname = multiDotRe.ReplaceAllString(hostname, ".")
+	return b.normalizeHostname(strings.Trim(hostname, "."))
+}
+
+// setGuestPools sets the resource pool of each guest from the cluster
+// resources list.
+func (b *Builder) setGuestPools(ctx context.Context, guests []*Guest) error {
+	resources, err := b.API.GetClusterResources(ctx, "vm")
+	if err != nil {
+		return err
+	}
+	pools := make(map[int]string)
+	for _, r := range resources.Data {
+		pools[r.Vmid] = r.Pool
+	}
+	for _, g := range guests {
+		g.Pool = pools[g.Vmid]
+	}
+	return nil
+}
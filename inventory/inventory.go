@@ -0,0 +1,350 @@
+// Package inventory builds the Ansible inventory of a Proxmox cluster
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// ProxmoxAPI is the part of the Proxmox API used to build the inventory. It
+// is satisfied by *proxmox.Client and can be replaced by a fake.
+type ProxmoxAPI interface {
+	GetClusterResources(ctx context.Context, resourceType string) (*proxmox.ClusterResources, error)
+	GetLxcConfig(ctx context.Context, node string, vmid int) (*proxmox.LxcConfig, error)
+	GetLxcInterfaces(ctx context.Context, node string, vmid int) (*proxmox.LxcInterfacesResponse, error)
+	GetLxcs(ctx context.Context, node string) (*proxmox.LxcResponse, error)
+	GetNodes(ctx context.Context) (*proxmox.NodeList, error)
+	GetQemuAgentHostName(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentHostNameResponse, error)
+	GetQemuAgentOSInfo(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentOSInfoResponse, error)
+	GetQemuAgentTimezone(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentTimezoneResponse, error)
+	GetQemuNetworkConfig(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentNetworkResponse, error)
+	GetVMConfig(ctx context.Context, node string, vmid int) (*proxmox.VMConfig, error)
+	GetVMs(ctx context.Context, node string) (*proxmox.VMList, error)
+}
+
+// Builder builds the Ansible inventory of a Proxmox cluster
+type Builder struct {
+	// API is the Proxmox API the guests are discovered through
+	API ProxmoxAPI
+	// Config is the configuration, of which the proxmox section is used
+	Config *config.Params
+	// Resolver is used for DNS lookups of inventory hostnames
+	Resolver Resolver
+}
+
+// NewBuilder creates a Builder for cfg that discovers the guests through api
+// and resolves hostnames through proxmox.dns.server.
+func NewBuilder(cfg *config.Params, api ProxmoxAPI) *Builder {
+	return &Builder{
+		API:      api,
+		Config:   cfg,
+		Resolver: NewResolver(cfg.Proxmox.DNS.Server),
+	}
+}
+
+// Build discovers the running guests of the Proxmox cluster and returns the
+// Ansible inventory for them.
+func (b *Builder) Build(ctx context.Context) (*ansible.Inventory, error) {
+	inv, _, err := b.Discover(ctx)
+	return inv, err
+}
+
+// Discover discovers the running guests of the Proxmox cluster and returns
+// the Ansible inventory for them along with the guests it contains. The
+// build is bounded by proxmox.timeout, if set.
+func (b *Builder) Discover(ctx context.Context) (*ansible.Inventory, []*Guest, error) {
+
+	// Bound the build by the configured deadline
+	if b.Config.Proxmox.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Config.Proxmox.Timeout)
+		defer cancel()
+	}
+
+	// Create proxmox inventory structure
+	inv := ansible.Inventory{
+		Meta: ansible.InventoryMeta{},
+		All:  ansible.InventoryAll{Children: []string{"proxmox_lxcs", "proxmox_vms", "ungrouped"}},
+	}
+
+	// Create host vars map
+	hostVarMap := make(ansible.MapHostVar)
+	inv.Meta.HostVars = hostVarMap
+
+	// Build excluded hosts set
+	excluded := mapset.NewSet(b.Config.Proxmox.Exclude...)
+
+	// Get list of Proxmox nodes
+	nodeList, err := b.API.GetNodes(ctx)
+	if err != nil {
+		return nil, nil, phaseError(ctx, "listing nodes", err)
+	}
+
+	roles := make(map[string][]string)
+	lxcNames := []string{}
+	vmNames := []string{}
+
+	// Get Proxmox virtual machines and containers from each Proxmox node
+	guests := []*Guest{}
+	for _, nodeData := range nodeList.Data {
+
+		// Get Proxmox VM list
+		vmList, err := b.API.GetVMs(ctx, nodeData.Node)
+		if err != nil {
+			err = fmt.Errorf("error getting proxmox vms: %w", err)
+			if err := b.skipNode(ctx, &inv, nodeData.Node, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		// Get Proxmox LXC list
+		lxcs, err := b.API.GetLxcs(ctx, nodeData.Node)
+		if err != nil {
+			err = fmt.Errorf("error getting proxmox lxcs: %w", err)
+			if err := b.skipNode(ctx, &inv, nodeData.Node, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		for _, vm := range vmList.Data {
+			if vm.Status != "running" {
+				continue
+			}
+			if excluded.ContainsOne(vm.Name) {
+				continue
+			}
+			guests = append(guests, &Guest{
+				CPUs:    vm.Cpus,
+				Maxdisk: vm.Maxdisk,
+				Maxmem:  vm.Maxmem,
+				Name:    vm.Name,
+				Node:    nodeData.Node,
+				Status:  vm.Status,
+				Tags:    splitTags(vm.Tags),
+				Type:    "qemu",
+				Uptime:  vm.Uptime,
+				Vmid:    vm.Vmid,
+			})
+		}
+
+		for _, lxc := range lxcs.Data {
+			if lxc.Status != "running" {
+				continue
+			}
+			if excluded.ContainsOne(lxc.Name) {
+				continue
+			}
+			guests = append(guests, &Guest{
+				CPUs:    lxc.Cpus,
+				Maxdisk: lxc.Maxdisk,
+				Maxmem:  lxc.Maxmem,
+				Name:    lxc.Name,
+				Node:    nodeData.Node,
+				Status:  lxc.Status,
+				Tags:    splitTags(lxc.Tags),
+				Type:    "lxc",
+				Uptime:  lxc.Uptime,
+				Vmid:    lxc.Vmid,
+			})
+		}
+	}
+
+	// Get the resource pool of each guest
+	if err := b.setGuestPools(ctx, guests); err != nil {
+		slog.Warn("failed to get cluster resources", "error", err)
+	}
+	if err := phaseError(ctx, "getting resource pools", nil); err != nil {
+		return nil, nil, err
+	}
+
+	// Determine the inventory hostname of each guest
+	guests, skipped := b.nameGuests(ctx, guests, excluded)
+	inv.Meta.Diagnostics = append(inv.Meta.Diagnostics, skipped...)
+	if err := phaseError(ctx, "naming guests", nil); err != nil {
+		return nil, nil, err
+	}
+
+	for _, g := range guests {
+		hostVarMap[g.Hostname] = guestHostVars(g)
+		if g.Type == "lxc" {
+			lxcNames = append(lxcNames, g.Hostname)
+		} else {
+			vmNames = append(vmNames, g.Hostname)
+		}
+		for _, tag := range g.Tags {
+			group := SanitizeGroupName(tag)
+			if !slices.Contains(inv.All.Children, group) {
+				inv.All.Children = append(inv.All.Children, group)
+			}
+			if _, exists := roles[group]; !exists {
+				roles[group] = []string{}
+			}
+			roles[group] = append(roles[group], g.Hostname)
+		}
+	}
+
+	// Lookup IP addresses for ansible_host hostvars
+	if b.Config.Proxmox.Lookup {
+		for _, g := range guests {
+			if g.Type == "lxc" {
+				b.lookupLxcAddresses(ctx, hostVarMap, g)
+			} else {
+				b.lookupVMAddresses(ctx, hostVarMap, g)
+			}
+		}
+		if err := phaseError(ctx, "looking up addresses", nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Collect the optional guest facts
+	facts := b.Config.Proxmox.Facts
+	if facts.Disks || facts.GuestOS || facts.Interfaces || facts.StorageGroups {
+		for _, g := range guests {
+			b.collectFacts(ctx, hostVarMap, roles, g)
+		}
+		for group := range roles {
+			if !slices.Contains(inv.All.Children, group) {
+				inv.All.Children = append(inv.All.Children, group)
+			}
+		}
+		if err := phaseError(ctx, "collecting guest facts", nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Strings(inv.All.Children)
+	sort.Strings(lxcNames)
+	sort.Strings(vmNames)
+
+	// Resolve and verify hostnames through DNS
+	if b.Config.Proxmox.DNS.Resolve || b.Config.Proxmox.DNS.Verify {
+		b.resolveHosts(ctx, hostVarMap, lxcNames)
+		b.resolveHosts(ctx, hostVarMap, vmNames)
+		if err := phaseError(ctx, "resolving hostnames", nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	inv.Groups = make(ansible.InventoryGroupMap)
+	inv.Groups["proxmox_lxcs"] = ansible.InventoryGroup{Hosts: lxcNames}
+	inv.Groups["proxmox_vms"] = ansible.InventoryGroup{Hosts: vmNames}
+	inv.Groups["ungrouped"] = ansible.InventoryGroup{Hosts: []string{}}
+
+	keys := []string{}
+	for k := range roles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		sort.Strings(roles[k])
+		if _, exists := inv.Groups[k]; !exists {
+			inv.Groups[k] = ansible.InventoryGroup{Hosts: roles[k]}
+		}
+		if !slices.Contains(inv.All.Children, k) {
+			inv.All.Children = append(inv.All.Children, k)
+		}
+	}
+
+	// Add the configured group variables. Viper lowercases the keys of the
+	// config file, so they match group names case-insensitively.
+	groupVars := make(map[string]map[string]any)
+	for name, vars := range b.Config.Proxmox.GroupVars {
+		groupVars[strings.ToLower(name)] = vars
+	}
+	if vars, exists := groupVars["all"]; exists {
+		inv.All.Vars = vars
+	}
+	for name, group := range inv.Groups {
+		if vars, exists := groupVars[strings.ToLower(name)]; exists {
+			group.Vars = vars
+			inv.Groups[name] = group
+		}
+	}
+
+	// Connect to Windows guests over WinRM unless configured otherwise
+	if group, exists := inv.Groups["os_windows"]; exists {
+		if _, set := group.Vars["ansible_connection"]; !set {
+			vars := ansible.HostVars{"ansible_connection": "winrm"}
+			for k, v := range group.Vars {
+				vars[k] = v
+			}
+			group.Vars = vars
+			inv.Groups["os_windows"] = group
+		}
+	}
+
+	return &inv, guests, nil
+}
+
+// skipNode applies the proxmox.on_error policy to a node whose guests could
+// not be listed. With fail_fast it returns the error, otherwise the node is
+// recorded in the inventory diagnostics and left out of the inventory. A
+// cancelled or timed out build is never skipped.
+func (b *Builder) skipNode(ctx context.Context, inv *ansible.Inventory, node string, err error) error {
+
+	if ctx.Err() != nil {
+		return phaseError(ctx, "listing the guests of node "+node, err)
+	}
+
+	switch b.Config.Proxmox.OnError {
+	case "skip_node":
+	case "skip_with_warning":
+		slog.Warn("skipping node", "node", node, "error", err)
+	default:
+		return err
+	}
+
+	inv.Meta.Diagnostics = append(inv.Meta.Diagnostics, ansible.Diagnostic{Node: node, Error: err.Error()})
+	return nil
+}
+
+// phaseError names the phase of the build in which ctx was cancelled or its
+// deadline passed. Otherwise it returns err unchanged, which is nil for a
+// phase that only logs its errors.
+func phaseError(ctx context.Context, phase string, err error) error {
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("inventory build timed out while %s: %w", phase, ctx.Err())
+	case ctx.Err() != nil:
+		return fmt.Errorf("inventory build cancelled while %s: %w", phase, ctx.Err())
+	}
+
+	return err
+}
+
+// fqdn returns the hostname with the configured domain appended, if set and
+// not already present.
+func (b *Builder) fqdn(name string) string {
+	if b.Config.Proxmox.Domain != "" && !strings.HasSuffix(name, "."+b.Config.Proxmox.Domain) {
+		return name + "." + b.Config.Proxmox.Domain
+	}
+	return name
+}
+
+var groupNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// SanitizeGroupName converts a Proxmox tag to a valid Ansible group name.
+// Ansible group names must match [a-zA-Z_][a-zA-Z0-9_]*.
+func SanitizeGroupName(tag string) string {
+	name := groupNameRe.ReplaceAllString(tag, "_")
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,246 @@
+package inventory_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox/proxmoxtest"
+)
+
+// stubResolver answers DNS lookups from a map of hostnames to addresses
+type stubResolver map[string][]string
+
+// LookupHost implements the inventory.Resolver interface for stubResolver
+func (r stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// newCluster starts a fake cluster of two nodes: pve1 runs the VM web1 and
+// the container db1, pve2 runs the VM app1.
+func newCluster(t *testing.T) *proxmoxtest.Server {
+	t.Helper()
+
+	f := proxmoxtest.Fixtures{}
+	fixtures := map[string]any{
+		"/nodes":             []proxmox.NodeData{{Node: "pve1"}, {Node: "pve2"}},
+		"/nodes/pve1/qemu":   []proxmox.VM{{Name: "web1", Vmid: 100, Status: "running"}},
+		"/nodes/pve1/lxc":    []proxmox.LxcData{{Name: "db1", Vmid: 200, Status: "running"}},
+		"/nodes/pve2/qemu":   []proxmox.VM{{Name: "app1", Vmid: 300, Status: "running"}},
+		"/nodes/pve2/lxc":    []proxmox.LxcData{},
+		"/cluster/resources": []proxmox.ClusterResource{},
+	}
+	for path, data := range fixtures {
+		if err := f.Set(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := proxmoxtest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newBuilder returns a Builder for the fake cluster using its configuration
+func newBuilder(srv *proxmoxtest.Server) *inventory.Builder {
+	cfg := srv.Config()
+	return inventory.NewBuilder(cfg, proxmox.NewClient(cfg))
+}
+
+func TestBuild(t *testing.T) {
+	srv := newCluster(t)
+
+	inv, err := newBuilder(srv).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inv.HostNames(), []string{"app1", "db1", "web1"}; !slices.Equal(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+	if got, want := inv.Groups["proxmox_vms"].Hosts, []string{"app1", "web1"}; !slices.Equal(got, want) {
+		t.Errorf("proxmox_vms = %v, want %v", got, want)
+	}
+	if inv.Degraded() {
+		t.Errorf("inventory is degraded: %+v", inv.Meta.Diagnostics)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	tests := []struct {
+		policy string
+		err    bool
+	}{
+		{"fail_fast", true},
+		{"skip_node", false},
+		{"skip_with_warning", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			srv := newCluster(t)
+			srv.Fail("/nodes/pve2/qemu", 595)
+			b := newBuilder(srv)
+			b.Config.Proxmox.OnError = tt.policy
+
+			inv, err := b.Build(context.Background())
+			if tt.err {
+				var statusErr *proxmox.StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != 595 {
+					t.Fatalf("error = %v, want status 595", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The guests of the unreachable node are left out and recorded
+			if got, want := inv.HostNames(), []string{"db1", "web1"}; !slices.Equal(got, want) {
+				t.Errorf("hosts = %v, want %v", got, want)
+			}
+			if !inv.Degraded() {
+				t.Fatal("inventory is not degraded")
+			}
+			if d := inv.Meta.Diagnostics; len(d) != 1 || d[0].Node != "pve2" || !strings.Contains(d[0].Error, "595") {
+				t.Errorf("diagnostics = %+v, want pve2 with status 595", d)
+			}
+			if got, want := inv.MissingNodes(), []string{"pve2"}; !slices.Equal(got, want) {
+				t.Errorf("MissingNodes = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHostnameCollision(t *testing.T) {
+	srv := newCluster(t)
+	if err := srv.SetFixture("/nodes/pve2/lxc", []proxmox.LxcData{{Name: "web1", Vmid: 400, Status: "running"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := newBuilder(srv).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The guest with the higher vmid is left out, but no node is missing
+	if got := inv.Meta.HostVars["web1"]["proxmox_vmid"]; got != 100 {
+		t.Errorf("web1 proxmox_vmid = %v, want 100", got)
+	}
+	if d := inv.Meta.Diagnostics; len(d) != 1 || d[0].Vmid != 400 {
+		t.Errorf("diagnostics = %+v, want vmid 400", d)
+	}
+	if got := inv.MissingNodes(); len(got) != 0 {
+		t.Errorf("MissingNodes = %v, want none", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		lookup bool
+		phase  string
+	}{
+		{"nodes", "/nodes", false, "listing nodes"},
+		{"guests", "/nodes/pve2/qemu", false, "listing the guests of node pve2"},
+		{"lookup", "/nodes/pve1/qemu/100/agent/network-get-interfaces", true, "looking up addresses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCluster(t)
+			srv.Delay(tt.path, time.Second)
+			b := newBuilder(srv)
+			b.Config.Proxmox.Lookup = tt.lookup
+			b.Config.Proxmox.LookupOrder = []string{"agent"}
+			b.Config.Proxmox.Timeout = 100 * time.Millisecond
+
+			_, err := b.Build(context.Background())
+			if err == nil {
+				t.Fatal("build succeeded, want a timeout")
+			}
+			if want := "inventory build timed out while " + tt.phase; !strings.HasPrefix(err.Error(), want) {
+				t.Errorf("error = %q, want prefix %q", err, want)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	srv := newCluster(t)
+	srv.Delay("/nodes", time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := newBuilder(srv).Build(ctx)
+	if err == nil || !strings.HasPrefix(err.Error(), "inventory build cancelled while listing nodes") {
+		t.Errorf("error = %v, want cancellation while listing nodes", err)
+	}
+}
+
+func TestLookupOrder(t *testing.T) {
+	agent := proxmox.QemuAgentNetworkData{Result: []proxmox.QemuAgentNetworkResult{
+		{Name: "lo", IPAddresses: []proxmox.QemuAgentIPAddresses{{IPAddress: "127.0.0.1", IPAddressType: "ipv4"}}},
+		{Name: "eth0", IPAddresses: []proxmox.QemuAgentIPAddresses{{IPAddress: "10.0.0.10", IPAddressType: "ipv4"}}},
+	}}
+	cloudInit := proxmox.VMConfigData{Ipconfig: map[int]string{0: "ip=10.0.1.10/24,gw=10.0.1.1"}}
+
+	tests := []struct {
+		name      string
+		agent     bool
+		cloudInit bool
+		dns       bool
+		source    any
+		host      any
+	}{
+		{"agent", true, true, true, "agent", "10.0.0.10"},
+		{"cloudinit", false, true, true, "cloudinit", "10.0.1.10"},
+		{"dns", false, false, true, "dns", "10.0.2.10"},
+		{"none", false, false, false, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCluster(t)
+			if tt.agent {
+				if err := srv.SetFixture("/nodes/pve1/qemu/100/agent/network-get-interfaces", agent); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				srv.Fail("/nodes/pve1/qemu/100/agent/network-get-interfaces", 500)
+			}
+			if tt.cloudInit {
+				if err := srv.SetFixture("/nodes/pve1/qemu/100/config", cloudInit); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b := newBuilder(srv)
+			b.Config.Proxmox.Lookup = true
+			b.Config.Proxmox.LookupOrder = []string{"agent", "cloudinit", "dns"}
+			resolver := stubResolver{}
+			if tt.dns {
+				resolver["web1"] = []string{"10.0.2.10"}
+			}
+			b.Resolver = resolver
+
+			inv, err := b.Build(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			vars := inv.Meta.HostVars["web1"]
+			if got := vars["proxmox_address_source"]; got != tt.source {
+				t.Errorf("proxmox_address_source = %v, want %v", got, tt.source)
+			}
+			if got := vars["ansible_host"]; got != tt.host {
+				t.Errorf("ansible_host = %v, want %v", got, tt.host)
+			}
+		})
+	}
+}
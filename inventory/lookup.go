@@ -0,0 +1,200 @@
+// Package inventory builds the Ansible inventory of a Proxmox cluster
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// lookupLxcAddresses resolves the addresses of an LXC container from its
+// net config, asking the running container for DHCP and SLAAC assigned
+// addresses, and falls back to DNS when enabled in proxmox.lookup_order.
+func (b *Builder) lookupLxcAddresses(ctx context.Context, hostVarMap ansible.MapHostVar, g *Guest) {
+
+	var errs []error
+	name := g.Hostname
+
+	ipv4, ipv6, err := b.lxcConfigAddresses(ctx, g)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(ipv4) > 0 || len(ipv6) > 0 {
+		b.setAddressHostVars(hostVarMap, name, "config", ipv4, ipv6)
+		return
+	}
+
+	if slices.Contains(b.Config.Proxmox.LookupOrder, "dns") {
+		ipv4, ipv6, err = b.dnsAddresses(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(ipv4) > 0 || len(ipv6) > 0 {
+			b.setAddressHostVars(hostVarMap, name, "dns", ipv4, ipv6)
+			return
+		}
+	}
+
+	if len(errs) > 0 {
+		slog.Warn("failed to find an address", "host", name, "error", errors.Join(errs...))
+	}
+}
+
+// lookupVMAddresses resolves the addresses of a QEMU VM by trying each source
+// in proxmox.lookup_order until one of them returns an address.
+func (b *Builder) lookupVMAddresses(ctx context.Context, hostVarMap ansible.MapHostVar, g *Guest) {
+
+	var errs []error
+	name := g.Hostname
+
+	for _, source := range b.Config.Proxmox.LookupOrder {
+		var ipv4, ipv6 []string
+		var err error
+		switch source {
+		case "agent":
+			ipv4, ipv6, err = b.agentAddresses(ctx, g)
+		case "cloudinit":
+			ipv4, ipv6, err = b.cloudInitAddresses(ctx, g)
+		case "dns":
+			ipv4, ipv6, err = b.dnsAddresses(ctx, name)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(ipv4) > 0 || len(ipv6) > 0 {
+			b.setAddressHostVars(hostVarMap, name, source, ipv4, ipv6)
+			return
+		}
+	}
+
+	if len(errs) > 0 {
+		slog.Warn("failed to find an address", "host", name, "error", errors.Join(errs...))
+	}
+}
+
+// lxcConfigAddresses returns the static addresses from the netN devices of
+// an LXC container plus any addresses assigned at runtime.
+func (b *Builder) lxcConfigAddresses(ctx context.Context, g *Guest) ([]string, []string, error) {
+
+	cfg, err := b.lxcConfig(ctx, g)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LXC config: %w", err)
+	}
+
+	var ipv4, ipv6 []string
+	dynamic := false
+	for _, i := range proxmox.Indexes(cfg.Net) {
+		net := cfg.Net[i]
+		if ip := proxmox.ParseLxcIP(net); ip != "" {
+			ipv4 = append(ipv4, ip)
+		}
+		if ip := proxmox.ParseLxcIP6(net); ip != "" {
+			ipv6 = append(ipv6, ip)
+		}
+		dynamic = dynamic || proxmox.IsDynamicLxcNet(net)
+	}
+	if !dynamic {
+		return ipv4, ipv6, nil
+	}
+
+	// Ask the running container for DHCP and SLAAC assigned addresses
+	ifaces, err := b.API.GetLxcInterfaces(ctx, g.Node, g.Vmid)
+	if err != nil {
+		return ipv4, ipv6, fmt.Errorf("LXC interfaces: %w", err)
+	}
+	dynIPv4, dynIPv6 := proxmox.LxcAddresses(ifaces.Data)
+	return appendUnique(ipv4, dynIPv4...), appendUnique(ipv6, dynIPv6...), nil
+}
+
+// agentAddresses returns the addresses reported by the QEMU guest agent.
+func (b *Builder) agentAddresses(ctx context.Context, g *Guest) ([]string, []string, error) {
+	results, err := b.agentNetwork(ctx, g)
+	if err != nil {
+		return nil, nil, fmt.Errorf("QEMU agent network info: %w", err)
+	}
+	ipv4, ipv6 := proxmox.QemuAddresses(results)
+	return ipv4, ipv6, nil
+}
+
+// cloudInitAddresses returns the static addresses from the cloud-init
+// ipconfigN settings of a QEMU VM.
+func (b *Builder) cloudInitAddresses(ctx context.Context, g *Guest) ([]string, []string, error) {
+	cfg, err := b.vmConfig(ctx, g)
+	if err != nil {
+		return nil, nil, fmt.Errorf("VM config: %w", err)
+	}
+	var ipv4, ipv6 []string
+	for _, i := range proxmox.Indexes(cfg.Ipconfig) {
+		ip, ip6 := proxmox.ParseIPConfig(cfg.Ipconfig[i])
+		if ip != "" {
+			ipv4 = append(ipv4, ip)
+		}
+		if ip6 != "" {
+			ipv6 = append(ipv6, ip6)
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// setAddressHostVars records the discovered addresses of a host as
+// proxmox_ipv4_addresses and proxmox_ipv6_addresses, the source they came
+// from as proxmox_address_source, and sets ansible_host to the address
+// selected by the configured address family.
+func (b *Builder) setAddressHostVars(hostVarMap ansible.MapHostVar, name string, source string, ipv4 []string, ipv6 []string) {
+	if len(ipv4) == 0 && len(ipv6) == 0 {
+		return
+	}
+	vars, ok := hostVarMap[name]
+	if !ok {
+		vars = ansible.HostVars{}
+		hostVarMap[name] = vars
+	}
+	if len(ipv4) > 0 {
+		vars["proxmox_ipv4_addresses"] = ipv4
+	}
+	if len(ipv6) > 0 {
+		vars["proxmox_ipv6_addresses"] = ipv6
+	}
+	vars["proxmox_address_source"] = source
+	if ip := b.selectAddress(ipv4, ipv6); ip != "" {
+		vars["ansible_host"] = ip
+	}
+}
+
+// selectAddress picks the ansible_host address according to the configured
+// address family, or returns empty string if no suitable address exists.
+func (b *Builder) selectAddress(ipv4 []string, ipv6 []string) string {
+	var first, second []string
+	switch b.Config.Proxmox.AddressFamily {
+	case "ipv4":
+		first = ipv4
+	case "ipv6":
+		first = ipv6
+	case "prefer_ipv6":
+		first, second = ipv6, ipv4
+	default:
+		first, second = ipv4, ipv6
+	}
+	if len(first) > 0 {
+		return first[0]
+	}
+	if len(second) > 0 {
+		return second[0]
+	}
+	return ""
+}
+
+// appendUnique appends the values not already present in list.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
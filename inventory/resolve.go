@@ -0,0 +1,107 @@
+// Package inventory builds the Ansible inventory of a Proxmox cluster
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+)
+
+// Resolver looks up the addresses of a hostname. It is satisfied by
+// *net.Resolver and can be replaced by a stub.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// NewResolver returns the system resolver if server is empty, otherwise a
+// resolver that sends every query to server. A missing port defaults to 53.
+func NewResolver(server string) Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dnsAddresses resolves the inventory hostname through the configured resolver.
+func (b *Builder) dnsAddresses(ctx context.Context, name string) ([]string, []string, error) {
+	addrs, err := b.Resolver.LookupHost(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DNS: %w", err)
+	}
+	var ipv4, ipv6 []string
+	for _, a := range addrs {
+		addr, err := netip.ParseAddr(a)
+		if err != nil {
+			continue
+		}
+		if addr.Is4() || addr.Is4In6() {
+			ipv4 = appendUnique(ipv4, addr.Unmap().String())
+		} else {
+			ipv6 = appendUnique(ipv6, addr.String())
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// resolveHosts resolves each hostname through DNS. Hosts without an
+// ansible_host get the DNS answer instead; when verification is enabled,
+// hosts whose DNS record contains none of the addresses reported by Proxmox
+// are flagged with proxmox_dns_mismatch and logged.
+func (b *Builder) resolveHosts(ctx context.Context, hostVarMap ansible.MapHostVar, names []string) {
+	for _, name := range names {
+		vars := hostVarMap[name]
+		if vars["proxmox_address_source"] == "dns" {
+			continue
+		}
+
+		ipv4, ipv6, err := b.dnsAddresses(ctx, name)
+		if err != nil {
+			if b.Config.Proxmox.DNS.Verify {
+				slog.Warn("failed to resolve host", "host", name, "error", err)
+			}
+			continue
+		}
+
+		host, ok := vars["ansible_host"].(string)
+		if !ok {
+			if b.Config.Proxmox.DNS.Resolve {
+				b.setAddressHostVars(hostVarMap, name, "dns", ipv4, ipv6)
+			}
+			continue
+		}
+
+		if b.Config.Proxmox.DNS.Verify {
+			answers := append(slices.Clone(ipv4), ipv6...)
+
+			// Any address reported by Proxmox in either family is a match, so
+			// a dual-stack host published only by its other family is not flagged
+			reported := []string{host}
+			for _, key := range []string{"proxmox_ipv4_addresses", "proxmox_ipv6_addresses"} {
+				if addrs, ok := vars[key].([]string); ok {
+					reported = append(reported, addrs...)
+				}
+			}
+			mismatch := !slices.ContainsFunc(answers, func(a string) bool { return slices.Contains(reported, a) })
+
+			vars["proxmox_dns_addresses"] = answers
+			vars["proxmox_dns_mismatch"] = mismatch
+			if mismatch {
+				slog.Warn("DNS record does not match Proxmox address", "host", name, "dns", answers, "proxmox", reported)
+			}
+		}
+	}
+}
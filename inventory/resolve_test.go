@@ -0,0 +1,241 @@
+package inventory_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// startDNSServer starts a UDP DNS server on the loopback interface answering
+// A and AAAA queries from records, and returns its address. Unknown names get
+// NXDOMAIN.
+func startDNSServer(t *testing.T, records map[string][]string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := dnsAnswer(buf[:n], records); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// dnsAnswer builds the response to a single question query, or returns nil
+// for a malformed query
+func dnsAnswer(query []byte, records map[string][]string) []byte {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return nil
+	}
+
+	// Read the question name
+	var labels []string
+	off := 12
+	for off < len(query) && query[off] != 0 {
+		l := int(query[off])
+		if off+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[off+1:off+1+l]))
+		off += 1 + l
+	}
+	if off+5 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[off+1:])
+	question := query[12 : off+5]
+
+	// Collect the answers of the queried family
+	addrs, ok := records[strings.ToLower(strings.Join(labels, "."))]
+	var answers [][]byte
+	for _, a := range addrs {
+		addr := netip.MustParseAddr(a)
+		if (qtype == 1 && addr.Is4()) || (qtype == 28 && addr.Is6()) {
+			answers = append(answers, addr.AsSlice())
+		}
+	}
+
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3
+	}
+	resp := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	resp = binary.BigEndian.AppendUint16(resp, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(answers)))
+	resp = binary.BigEndian.AppendUint32(resp, 0)
+	resp = append(resp, question...)
+	for _, ip := range answers {
+		// Name pointer to the question, type, class IN, TTL and the address
+		resp = binary.BigEndian.AppendUint16(resp, 0xc00c)
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, 1)
+		resp = binary.BigEndian.AppendUint32(resp, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(ip)))
+		resp = append(resp, ip...)
+	}
+	return resp
+}
+
+func TestResolveHosts(t *testing.T) {
+	agent := proxmox.QemuAgentNetworkData{Result: []proxmox.QemuAgentNetworkResult{
+		{Name: "eth0", IPAddresses: []proxmox.QemuAgentIPAddresses{
+			{IPAddress: "10.0.0.10", IPAddressType: "ipv4"},
+			{IPAddress: "fd00::10", IPAddressType: "ipv6"},
+		}},
+	}}
+
+	tests := []struct {
+		name     string
+		lookup   bool
+		resolve  bool
+		verify   bool
+		records  stubResolver
+		host     any
+		source   any
+		answers  []string
+		mismatch any
+	}{
+		{
+			name:    "resolve without lookup",
+			resolve: true,
+			records: stubResolver{"web1": {"10.0.2.10", "fd00::10"}},
+			host:    "10.0.2.10",
+			source:  "dns",
+		},
+		{
+			name:    "resolve keeps the proxmox address",
+			lookup:  true,
+			resolve: true,
+			records: stubResolver{"web1": {"10.0.2.10"}},
+			host:    "10.0.0.10",
+			source:  "agent",
+		},
+		{
+			name:    "resolve without record",
+			resolve: true,
+			records: stubResolver{},
+		},
+		{
+			name:     "verify match",
+			lookup:   true,
+			verify:   true,
+			records:  stubResolver{"web1": {"10.0.0.10", "fd00::10"}},
+			host:     "10.0.0.10",
+			source:   "agent",
+			answers:  []string{"10.0.0.10", "fd00::10"},
+			mismatch: false,
+		},
+		{
+			name:     "verify mismatch",
+			lookup:   true,
+			verify:   true,
+			records:  stubResolver{"web1": {"10.9.9.9"}},
+			host:     "10.0.0.10",
+			source:   "agent",
+			answers:  []string{"10.9.9.9"},
+			mismatch: true,
+		},
+		{
+			name:     "verify dual-stack match by the other family",
+			lookup:   true,
+			verify:   true,
+			records:  stubResolver{"web1": {"fd00::10"}},
+			host:     "10.0.0.10",
+			source:   "agent",
+			answers:  []string{"fd00::10"},
+			mismatch: false,
+		},
+		{
+			name:    "verify without record",
+			lookup:  true,
+			verify:  true,
+			records: stubResolver{},
+			host:    "10.0.0.10",
+			source:  "agent",
+		},
+		{
+			name:    "verify without proxmox address",
+			verify:  true,
+			records: stubResolver{"web1": {"10.0.2.10"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCluster(t)
+			if err := srv.SetFixture("/nodes/pve1/qemu/100/agent/network-get-interfaces", agent); err != nil {
+				t.Fatal(err)
+			}
+			b := newBuilder(srv)
+			b.Config.Proxmox.Lookup = tt.lookup
+			b.Config.Proxmox.LookupOrder = []string{"agent"}
+			b.Config.Proxmox.DNS.Resolve = tt.resolve
+			b.Config.Proxmox.DNS.Verify = tt.verify
+			b.Resolver = tt.records
+
+			inv, err := b.Build(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			vars := inv.Meta.HostVars["web1"]
+			if got := vars["ansible_host"]; got != tt.host {
+				t.Errorf("ansible_host = %v, want %v", got, tt.host)
+			}
+			if got := vars["proxmox_address_source"]; got != tt.source {
+				t.Errorf("proxmox_address_source = %v, want %v", got, tt.source)
+			}
+			answers, _ := vars["proxmox_dns_addresses"].([]string)
+			if !slices.Equal(answers, tt.answers) {
+				t.Errorf("proxmox_dns_addresses = %v, want %v", vars["proxmox_dns_addresses"], tt.answers)
+			}
+			if got := vars["proxmox_dns_mismatch"]; got != tt.mismatch {
+				t.Errorf("proxmox_dns_mismatch = %v, want %v", got, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	server := startDNSServer(t, map[string][]string{"web1": {"10.0.2.10", "fd00::10"}})
+
+	// Resolve through a builder configured with the custom server
+	srv := newCluster(t)
+	cfg := srv.Config()
+	cfg.Proxmox.DNS.Resolve = true
+	cfg.Proxmox.DNS.Server = server
+	b := inventory.NewBuilder(cfg, proxmox.NewClient(cfg))
+
+	inv, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := inv.Meta.HostVars["web1"]
+	if got := vars["ansible_host"]; got != "10.0.2.10" {
+		t.Errorf("ansible_host = %v, want 10.0.2.10", got)
+	}
+	if got, _ := vars["proxmox_ipv6_addresses"].([]string); !slices.Equal(got, []string{"fd00::10"}) {
+		t.Errorf("proxmox_ipv6_addresses = %v, want [fd00::10]", vars["proxmox_ipv6_addresses"])
+	}
+	if _, ok := inv.Meta.HostVars["db1"]["ansible_host"]; ok {
+		t.Errorf("db1 ansible_host = %v, want none", inv.Meta.HostVars["db1"]["ansible_host"])
+	}
+}
@@ -6,15 +6,18 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
-	"regexp"
+	"os/signal"
 	"slices"
-	"sort"
 	"strings"
+	"syscall"
+	"time"
 
-	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
 	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/output"
 	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -23,8 +26,6 @@ import (
 var (
 	// Config is the configuration parameters used by proxmox-ansible-inventory
 	Config = config.Params{}
-	// ExcludedHosts is a set of excluded hosts
-	excludedHosts = mapset.NewSet[string]()
 	// GitVersion is the version of the program
 	GitVersion = "unknown"
 	// GitSha is the git commit hash
@@ -32,35 +33,71 @@ var (
 	// GitDate is the date the program was built
 	GitDate = "unknown"
 	// Flags used by this program
-	helpFlag    bool
-	hostFlag    string
-	listFlag    bool
-	versionFlag bool
+	columnsFlag      []string
+	diffFormatFlag   string
+	exitCodeFlag     bool
+	exitDegradedFlag bool
+	formatFlag       string
+	groupFlag        string
+	helpFlag         bool
+	hostFlag         string
+	listFlag         bool
+	listenFlag       string
+	logFormatFlag    string
+	outputFlag       string
+	recordFlag       string
+	refreshFlag      time.Duration
+	replayFlag       string
+	reportFormatFlag string
+	saveFlag         bool
+	snapshotFlag     string
+	sortFlag         string
+	timeoutFlag      time.Duration
+	verboseFlag      int
+	versionFlag      bool
 )
 
 func init() {
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.StringSliceVarP(&columnsFlag, "columns", "", []string{"name", "vmid", "node", "type", "cpus", "maxmem", "maxdisk", "ip"}, "report columns: "+strings.Join(reportColumns, ", ")+" (report)")
+	pflag.StringVarP(&diffFormatFlag, "diff-format", "", "text", "diff output format: text or json (diff)")
+	pflag.BoolVarP(&exitCodeFlag, "exit-code", "", false, "exit with status 2 when the inventory changed (diff)")
+	pflag.BoolVarP(&exitDegradedFlag, "exit-degraded", "", false, "exit with status 3 when nodes or guests were left out of the inventory")
+	pflag.StringVarP(&formatFlag, "format", "", "json", "output format: "+strings.Join(output.Formats, ", "))
+	pflag.StringVarP(&groupFlag, "group", "", "", "only report the hosts of this group (report)")
 	pflag.BoolVarP(&helpFlag, "help", "h", false, "show program help")
 	pflag.StringVarP(&hostFlag, "host", "", "", "show variables for a single host")
 	pflag.BoolVarP(&listFlag, "list", "", true, "list the inventory")
+	pflag.StringVarP(&listenFlag, "listen", "", ":8080", "address the HTTP server listens on (serve)")
+	pflag.StringVarP(&logFormatFlag, "log-format", "", "text", "log format: text or json")
+	pflag.StringVarP(&outputFlag, "output", "o", "", "write the output to a file instead of stdout")
+	pflag.StringVarP(&recordFlag, "record", "", "", "save every Proxmox API response in this directory, with secrets scrubbed")
+	pflag.DurationVarP(&refreshFlag, "refresh", "", 5*time.Minute, "interval between inventory refreshes (serve)")
+	pflag.StringVarP(&replayFlag, "replay", "", "", "answer Proxmox API requests from the responses recorded in this directory")
+	pflag.StringVarP(&reportFormatFlag, "report-format", "", "table", "report format: table, csv or markdown (report)")
+	pflag.BoolVarP(&saveFlag, "save", "", false, "save the current inventory as the new snapshot (diff)")
+	pflag.StringVarP(&snapshotFlag, "snapshot", "", "", "inventory snapshot to compare against (diff)")
+	pflag.StringVarP(&sortFlag, "sort", "", "name", "report sort column, prefix with - for descending order (report)")
+	pflag.DurationVarP(&timeoutFlag, "timeout", "", 0, "deadline for building the inventory, overrides proxmox.timeout")
+	pflag.CountVarP(&verboseFlag, "verbose", "v", "increase log verbosity (-v for info, -vv for debug)")
 	pflag.BoolVarP(&versionFlag, "version", "", false, "show program version")
 }
 
 func main() {
 
-	// Setup viper
-	err := setupViper()
+	// Parse command line flags
+	pflag.Parse()
+
+	// Setup logging
+	err := setupLogger()
 	if err != nil {
-		fmt.Printf("error setting up viper: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error setting up logging: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Parse command line flags
-	pflag.Parse()
-
 	// Show help if requested
 	if helpFlag {
-		fmt.Printf("Usage: %s [options]\n", os.Args[0])
+		fmt.Printf("Usage: %s [options] [serve|diff|watch|report]\n", os.Args[0])
 		pflag.PrintDefaults()
 		os.Exit(0)
 	}
@@ -71,206 +108,180 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Build excluded hosts map
-	excludedHosts.Append(Config.Proxmox.Exclude...)
-
-	// Create a new Proxmox client
-	ctx := context.Background()
+	// Setup viper
+	err = setupViper()
+	if err != nil {
+		fatal("error setting up viper", "error", err)
+	}
 
-	pm := proxmox.NewClient(&Config)
+	// Check the output format
+	if !slices.Contains(output.Formats, formatFlag) {
+		fatal("unknown output format", "format", formatFlag, "formats", output.Formats)
+	}
 
-	// Create proxmox inventory structure
-	inv := ansible.Inventory{
-		Meta: ansible.InventoryMeta{},
-		All:  ansible.InventoryAll{Children: []string{"proxmox_lxcs", "proxmox_vms", "ungrouped"}},
+	// Use the --timeout flag over the configured deadline
+	if pflag.CommandLine.Changed("timeout") {
+		Config.Proxmox.Timeout = timeoutFlag
 	}
 
-	// Create host vars map
-	hostVarMap := make(ansible.MapHostVar)
-	inv.Meta.HostVars = hostVarMap
+	// Cancel in-flight requests when SIGINT or SIGTERM is received
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Get list of Proxmox nodes
-	nodeList, err := pm.GetNodes(ctx)
-	if err != nil {
-		fmt.Printf("error: %s\n", err)
-		os.Exit(1)
-	}
+	// Create a new Proxmox client
+	pm := proxmox.NewClient(&Config)
 
-	type hostInfo struct {
-		node string
-		vmid int
+	// Record or replay the API responses if requested
+	switch {
+	case recordFlag != "" && replayFlag != "":
+		fatal("--record and --replay cannot be used together")
+	case recordFlag != "":
+		pm.HTTPClient.Transport = &proxmox.RecordTransport{Dir: recordFlag, Transport: pm.HTTPClient.Transport}
+	case replayFlag != "":
+		pm.HTTPClient.Transport = &proxmox.ReplayTransport{Dir: replayFlag}
 	}
 
-	roles := make(map[string][]string)
-	lxcNames := []string{}
-	vmNames := []string{}
-	lxcHosts := make(map[string]hostInfo)
-	vmHosts := make(map[string]hostInfo)
+	// Create an inventory builder using the client
+	b := inventory.NewBuilder(&Config, pm)
 
-	// Get Proxmox virtual machines and containers from each Proxmox node
-	for _, nodeData := range nodeList.Data {
-
-		// Get Proxmox VM list
-		vmList, err := pm.GetVMs(ctx, nodeData.Node)
-		if err != nil {
-			fmt.Printf("error getting proxmox vms: %s\n", err)
-			os.Exit(1)
-		}
-		for _, vm := range vmList.Data {
-			if vm.Status != "running" {
-				continue
-			}
-			if excludedHosts.ContainsOne(vm.Name) {
-				continue
-			}
-			hostname := fqdn(vm.Name)
-			vmNames = append(vmNames, hostname)
-			vmHosts[hostname] = hostInfo{node: nodeData.Node, vmid: vm.Vmid}
-			tags := strings.Split(strings.Trim(vm.Tags, " "), ";")
-			for _, tag := range tags {
-				if tag == "" {
-					continue
-				}
-				group := sanitizeGroupName(tag)
-				if !slices.Contains(inv.All.Children, group) {
-					inv.All.Children = append(inv.All.Children, group)
-				}
-				if _, exists := roles[group]; !exists {
-					roles[group] = []string{}
-				}
-				roles[group] = append(roles[group], hostname)
-			}
+	// Run the HTTP server if requested
+	if pflag.Arg(0) == "serve" {
+		if err := serve(ctx, b); err != nil {
+			fatal("error serving inventory", "error", err)
 		}
+		os.Exit(0)
+	}
 
-		// Get Proxmox LXC list
-		lxcs, err := pm.GetLxcs(ctx, nodeData.Node)
+	// Compare the inventory with a snapshot if requested
+	if pflag.Arg(0) == "diff" {
+		changed, err := runDiff(ctx, b)
 		if err != nil {
-			fmt.Printf("error getting proxmox lxcs: %s\n", err)
-			os.Exit(1)
+			fatal("error comparing inventory", "error", err)
 		}
-		for _, lxc := range lxcs.Data {
-			if lxc.Status != "running" {
-				continue
-			}
-			if excludedHosts.ContainsOne(lxc.Name) {
-				continue
-			}
-			hostname := fqdn(lxc.Name)
-			lxcNames = append(lxcNames, hostname)
-			lxcHosts[hostname] = hostInfo{node: nodeData.Node, vmid: lxc.Vmid}
-			tags := strings.Split(strings.Trim(lxc.Tags, " "), ";")
-			for _, tag := range tags {
-				if tag == "" {
-					continue
-				}
-				group := sanitizeGroupName(tag)
-				if !slices.Contains(inv.All.Children, group) {
-					inv.All.Children = append(inv.All.Children, group)
-				}
-				if _, exists := roles[group]; !exists {
-					roles[group] = []string{}
-				}
-				roles[group] = append(roles[group], hostname)
-			}
+		if changed && exitCodeFlag {
+			os.Exit(2)
 		}
+		os.Exit(0)
 	}
 
-	// Lookup IP addresses for ansible_host hostvars
-	if Config.Proxmox.Lookup {
-		for name, info := range lxcHosts {
-			cfg, err := pm.GetLxcConfig(ctx, info.node, info.vmid)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: failed to get LXC config for %s: %v\n", name, err)
-				continue
-			}
-			// Try Net0 through Net4
-			for _, net := range []string{cfg.Data.Net0, cfg.Data.Net1, cfg.Data.Net2, cfg.Data.Net3, cfg.Data.Net4} {
-				if ip := proxmox.ParseLxcIP(net); ip != "" {
-					hostVarMap[name] = map[string]string{"ansible_host": ip}
-					break
-				}
-			}
-		}
-		for name, info := range vmHosts {
-			netResp, err := pm.GetQemuNetworkConfig(ctx, info.node, info.vmid)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: failed to get QEMU agent network info for %s: %v\n", name, err)
-				continue
-			}
-			if ip := proxmox.FindQemuIPv4(netResp.Data.Result); ip != "" {
-				hostVarMap[name] = map[string]string{"ansible_host": ip}
-			}
+	// Watch the cluster and regenerate the outputs if requested
+	if pflag.Arg(0) == "watch" {
+		if err := watch(ctx, b); err != nil {
+			fatal("error watching cluster", "error", err)
 		}
+		os.Exit(0)
 	}
 
-	sort.Strings(inv.All.Children)
-	sort.Strings(lxcNames)
-	sort.Strings(vmNames)
-	inv.Groups = make(ansible.InventoryGroupMap)
-	inv.Groups["proxmox_lxcs"] = ansible.InventoryGroup{Hosts: lxcNames}
-	inv.Groups["proxmox_vms"] = ansible.InventoryGroup{Hosts: vmNames}
-	inv.Groups["ungrouped"] = ansible.InventoryGroup{Hosts: []string{}}
-
-	keys := []string{}
-	for k := range roles {
-		keys = append(keys, k)
+	// Print a report of the guests if requested
+	if pflag.Arg(0) == "report" {
+		if err := runReport(ctx, b, os.Stdout); err != nil {
+			fatal("error creating report", "error", err)
+		}
+		os.Exit(0)
 	}
-	sort.Strings(keys)
 
-	for _, k := range keys {
-		sort.Strings(roles[k])
-		if _, exists := inv.Groups[k]; !exists {
-			inv.Groups[k] = ansible.InventoryGroup{Hosts: roles[k]}
-		}
-		if !slices.Contains(inv.All.Children, k) {
-			inv.All.Children = append(inv.All.Children, k)
-		}
+	// Build the inventory
+	inv, err := b.Build(ctx)
+	if err != nil {
+		fatal("error building inventory", "error", err)
 	}
 
 	// Handle --host: output hostvars for a single host
+	var str []byte
 	if hostFlag != "" {
-		vars := map[string]string{}
-		if hv, ok := hostVarMap[hostFlag]; ok {
+		vars := ansible.HostVars{}
+		if hv, ok := inv.Meta.HostVars[hostFlag]; ok {
 			vars = hv
 		}
-		str, err := json.MarshalIndent(vars, "", "   ")
+		str, err = json.MarshalIndent(vars, "", "   ")
 		if err != nil {
-			fmt.Printf("error marshalling json: %v\n", err)
-			os.Exit(1)
+			fatal("error marshalling json", "error", err)
 		}
 		fmt.Printf("%s\n", str)
-		os.Exit(0)
+		exit(inv)
 	}
 
-	// Pretty print our json inventory
-	str, err := json.MarshalIndent(inv, "", "   ")
+	// Render the inventory in the requested format
+	var previous []byte
+	if outputFlag != "" {
+		previous, _ = os.ReadFile(outputFlag)
+	}
+	if formatFlag == "terraform" {
+		str, err = renderTerraform(inv)
+	} else {
+		str, err = output.Render(formatFlag, inv, &Config, previous)
+	}
 	if err != nil {
-		fmt.Printf("error marshalling json: %v\n", err)
-		os.Exit(1)
+		fatal("error rendering output", "format", formatFlag, "error", err)
 	}
-	fmt.Printf("%s\n", str)
 
-	os.Exit(0)
+	// Write the output to a file if requested, otherwise print it
+	if outputFlag != "" {
+		if err := output.WriteFile(outputFlag, str); err != nil {
+			fatal("error writing output", "path", outputFlag, "error", err)
+		}
+		exit(inv)
+	}
+	os.Stdout.Write(str)
+
+	exit(inv)
 }
 
-// fqdn returns the hostname with the configured domain appended, if set.
-func fqdn(name string) string {
-	if Config.Proxmox.Domain != "" {
-		return name + "." + Config.Proxmox.Domain
+// exit exits with status 3 if the inventory is degraded and --exit-degraded
+// is set, otherwise with status 0.
+func exit(inv *ansible.Inventory) {
+	if exitDegradedFlag && inv.Degraded() {
+		os.Exit(3)
 	}
-	return name
+	os.Exit(0)
 }
 
-var groupNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+// renderTerraform renders the inventory for Terraform's external data source,
+// reading the query from stdin unless it is a terminal.
+func renderTerraform(inv *ansible.Inventory) ([]byte, error) {
+	query := map[string]string{}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		query, err = output.ReadTerraformQuery(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output.Terraform(inv, query)
+}
 
-// sanitizeGroupName converts a Proxmox tag to a valid Ansible group name.
-// Ansible group names must match [a-zA-Z_][a-zA-Z0-9_]*.
-func sanitizeGroupName(tag string) string {
-	name := groupNameRe.ReplaceAllString(tag, "_")
-	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
-		name = "_" + name
+// setupLogger routes all diagnostics through log/slog to stderr, at the
+// level selected by -v and in the format selected by --log-format.
+func setupLogger() error {
+
+	// Map the verbosity to a log level
+	level := slog.LevelWarn
+	switch {
+	case verboseFlag == 1:
+		level = slog.LevelInfo
+	case verboseFlag >= 2:
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	// Create the handler
+	var handler slog.Handler
+	switch logFormatFlag {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (must be text or json)", logFormatFlag)
 	}
-	return name
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs an error and exits with status 1
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 // setupViper sets up the viper configuration
@@ -284,8 +295,7 @@ func setupViper() error {
 	viper.AddConfigPath("$HOME/.config/proxmox-ansible-inventory/")
 
 	// Set defaults
-	viper.SetDefault("proxmox.domain", "")
-	viper.SetDefault("proxmox.lookup", false)
+	config.SetDefaults(viper.GetViper())
 
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
@@ -0,0 +1,76 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"encoding/json"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+)
+
+// TargetGroup is a Prometheus static target group as used by file_sd and
+// http_sd service discovery
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// FileSD renders the inventory as Prometheus file_sd JSON
+func FileSD(inv *ansible.Inventory, cfg *config.Params) ([]byte, error) {
+	str, err := json.MarshalIndent(TargetGroups(inv, cfg), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(str, '\n'), nil
+}
+
+// TargetGroups returns one Prometheus target group per host with the ports
+// from prometheus.default_ports and the prometheus.ports of its tags. Hosts
+// without any port are left out. The labels describe the guest: its
+// inventory hostname, node, vmid, type, pool and tags. Tags are joined as
+// ",tag1,tag2," so they can be matched with a regex such as ".*,web,.*".
+func TargetGroups(inv *ansible.Inventory, cfg *config.Params) []TargetGroup {
+
+	groups := []TargetGroup{}
+	for _, host := range inv.HostNames() {
+
+		// Collect the ports to scrape
+		tags := hostVarStrings(inv, host, "proxmox_tags")
+		ports := slices.Clone(cfg.Prometheus.DefaultPorts)
+		for _, tag := range tags {
+			ports = append(ports, cfg.Prometheus.Ports[strings.ToLower(tag)]...)
+		}
+		if len(ports) == 0 {
+			continue
+		}
+		sort.Ints(ports)
+		ports = slices.Compact(ports)
+
+		// Build the targets
+		addr := hostAddress(inv, host)
+		targets := make([]string, 0, len(ports))
+		for _, port := range ports {
+			targets = append(targets, net.JoinHostPort(addr, strconv.Itoa(port)))
+		}
+
+		// Build the labels
+		labels := map[string]string{"proxmox_host": host}
+		for _, key := range []string{"proxmox_node", "proxmox_pool", "proxmox_type", "proxmox_vmid"} {
+			if v := hostVarString(inv, host, key); v != "" {
+				labels[key] = v
+			}
+		}
+		if len(tags) > 0 {
+			labels["proxmox_tags"] = "," + strings.Join(tags, ",") + ","
+		}
+
+		groups = append(groups, TargetGroup{Targets: targets, Labels: labels})
+	}
+
+	return groups
+}
@@ -0,0 +1,64 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+)
+
+// HostsHeader is the marker written at the top of generated hosts files
+const HostsHeader = "# Generated by proxmox-ansible-inventory. Do not edit, changes will be overwritten."
+
+// Hosts renders the inventory as an /etc/hosts fragment with one line per
+// address, listing the inventory hostname and its short name as an alias.
+// Hosts without a known address or a valid DNS host name are left out.
+func Hosts(inv *ansible.Inventory) ([]byte, error) {
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, HostsHeader)
+
+	for _, host := range inv.HostNames() {
+		if !ansible.ValidHostName(host) {
+			continue
+		}
+		names := host
+		if short := shortName(host); short != host {
+			names += " " + short
+		}
+		for _, addr := range hostAddresses(inv, host) {
+			fmt.Fprintf(&buf, "%-39s %s\n", addr, names)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// hostAddresses returns the IP addresses published for a host: its
+// ansible_host address followed by the first address of the other family, so
+// dual stack hosts get both an IPv4 and an IPv6 entry.
+func hostAddresses(inv *ansible.Inventory, host string) []netip.Addr {
+
+	var addrs []netip.Addr
+	primary, err := netip.ParseAddr(hostVarString(inv, host, "ansible_host"))
+	if err != nil {
+		return nil
+	}
+	addrs = append(addrs, primary)
+
+	key := "proxmox_ipv6_addresses"
+	if primary.Is6() {
+		key = "proxmox_ipv4_addresses"
+	}
+	for _, a := range hostVarStrings(inv, host, key) {
+		if addr, err := netip.ParseAddr(a); err == nil && !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+			break
+		}
+	}
+
+	return addrs
+}
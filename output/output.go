@@ -0,0 +1,109 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+)
+
+// Formats are the supported output formats
+var Formats = []string{"json", "file_sd", "hosts", "reverse-zone", "ssh-config", "terraform", "yaml", "zone"}
+
+// Render renders the inventory in the given output format. The previous
+// output, if any, carries state across runs such as the zone file serial.
+func Render(format string, inv *ansible.Inventory, cfg *config.Params, previous []byte) ([]byte, error) {
+	switch format {
+	case "json":
+		return JSON(inv)
+	case "file_sd":
+		return FileSD(inv, cfg)
+	case "hosts":
+		return Hosts(inv)
+	case "reverse-zone":
+		return ReverseZone(inv, cfg, previous)
+	case "ssh-config":
+		return SSHConfig(inv)
+	case "terraform":
+		return Terraform(inv, nil)
+	case "yaml":
+		return YAML(inv)
+	case "zone":
+		return Zone(inv, cfg, previous)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// JSON renders the inventory in the format expected by Ansible's script
+// inventory plugin
+func JSON(inv *ansible.Inventory) ([]byte, error) {
+	str, err := json.MarshalIndent(inv, "", "   ")
+	if err != nil {
+		return nil, err
+	}
+	return append(str, '\n'), nil
+}
+
+// WriteFile atomically replaces the file at path with data by writing to a
+// temporary file in the same directory and renaming it into place, so readers
+// never observe a partially written file.
+func WriteFile(path string, data []byte) error {
+
+	// Write the data to a temporary file next to the target
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Move the temporary file into place
+	return os.Rename(tmp.Name(), path)
+}
+
+// hostAddress returns the address used to reach a host: its ansible_host
+// variable if set, otherwise the inventory hostname.
+func hostAddress(inv *ansible.Inventory, host string) string {
+	if addr, ok := inv.Meta.HostVars[host]["ansible_host"].(string); ok && addr != "" {
+		return addr
+	}
+	return host
+}
+
+// hostVarString returns a host variable formatted as a string, or empty
+// string if it is not set.
+func hostVarString(inv *ansible.Inventory, host string, key string) string {
+	return varString(inv.Meta.HostVars[host][key])
+}
+
+// hostVarStrings returns a list host variable such as proxmox_tags as a
+// slice of strings.
+func hostVarStrings(inv *ansible.Inventory, host string, key string) []string {
+	switch v := inv.Meta.HostVars[host][key].(type) {
+	case []string:
+		return v
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+)
+
+// SSHConfigHeader is the marker written at the top of generated ssh configs
+const SSHConfigHeader = "# Generated by proxmox-ansible-inventory. Do not edit, changes will be overwritten."
+
+// SSHConfig renders the inventory as an OpenSSH client config with one Host
+// block per host. The HostName, User, Port and ProxyJump options come from
+// the merged group and host variables ansible_host, ansible_user,
+// ansible_port and the -J or ProxyJump option in ansible_ssh_common_args or
+// ansible_ssh_extra_args; HostName is the inventory hostname for hosts
+// without ansible_host. Hosts also get their short name as an alias when it
+// is unique, so "ssh web1" works for "web1.example.com". The output only
+// depends on the inventory, so regenerating an unchanged inventory produces
+// an identical file. Hosts whose name is not a valid DNS host name are left
+// out, as the name could otherwise inject options into the config.
+func SSHConfig(inv *ansible.Inventory) ([]byte, error) {
+
+	hosts := inv.HostNames()
+
+	// Count the short names to only alias the unique ones
+	shortNames := make(map[string]int)
+	for _, host := range hosts {
+		shortNames[shortName(host)]++
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, SSHConfigHeader)
+	fmt.Fprintln(&buf, "# Include it from ~/.ssh/config, e.g.: Include ~/.ssh/config.d/proxmox")
+
+	for _, host := range hosts {
+		if !ansible.ValidHostName(host) {
+			continue
+		}
+		vars := inv.MergedVars(host)
+
+		patterns := []string{host}
+		if short := shortName(host); short != host && shortNames[short] == 1 && !slices.Contains(hosts, short) {
+			patterns = append(patterns, short)
+		}
+
+		fmt.Fprintf(&buf, "\nHost %s\n", strings.Join(patterns, " "))
+		// Connect to the inventory hostname without ansible_host, like Ansible
+		hostName := varString(vars["ansible_host"])
+		if hostName == "" {
+			hostName = host
+		}
+		writeSSHOption(&buf, "HostName", hostName)
+		writeSSHOption(&buf, "User", varString(vars["ansible_user"]))
+		writeSSHOption(&buf, "Port", varString(vars["ansible_port"]))
+		proxyJump := proxyJumpArg(varString(vars["ansible_ssh_common_args"]))
+		if proxyJump == "" {
+			proxyJump = proxyJumpArg(varString(vars["ansible_ssh_extra_args"]))
+		}
+		writeSSHOption(&buf, "ProxyJump", proxyJump)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeSSHOption writes an indented ssh config option, quoting values that
+// contain whitespace. Empty values and values spanning lines are skipped.
+func writeSSHOption(buf *bytes.Buffer, key string, value string) {
+	if value == "" || strings.ContainsAny(value, "\r\n") {
+		return
+	}
+	if strings.ContainsAny(value, " \t") {
+		value = `"` + strings.ReplaceAll(value, `"`, ``) + `"`
+	}
+	fmt.Fprintf(buf, "    %s %s\n", key, value)
+}
+
+// proxyJumpArg extracts the jump host from ssh arguments such as
+// "-J bastion", "-Jbastion" or "-o ProxyJump=bastion".
+func proxyJumpArg(args string) string {
+	fields := strings.Fields(args)
+	for i, field := range fields {
+		switch {
+		case field == "-J" && i+1 < len(fields):
+			return fields[i+1]
+		case strings.HasPrefix(field, "-J"):
+			return strings.TrimPrefix(field, "-J")
+		case field == "-o" && i+1 < len(fields):
+			if jump, ok := proxyJumpOption(fields[i+1]); ok {
+				return jump
+			}
+		case strings.HasPrefix(field, "-o"):
+			if jump, ok := proxyJumpOption(strings.TrimPrefix(field, "-o")); ok {
+				return jump
+			}
+		}
+	}
+	return ""
+}
+
+// proxyJumpOption parses a "ProxyJump=host" ssh option
+func proxyJumpOption(option string) (string, bool) {
+	key, value, ok := strings.Cut(strings.Trim(option, `"'`), "=")
+	if !ok || !strings.EqualFold(key, "ProxyJump") {
+		return "", false
+	}
+	return value, true
+}
+
+// shortName returns the first label of a hostname
+func shortName(host string) string {
+	short, _, _ := strings.Cut(host, ".")
+	return short
+}
+
+// varString formats a variable value as a string, or empty string if unset
+func varString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
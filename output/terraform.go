@@ -0,0 +1,91 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+)
+
+// terraformAttributes maps the short attribute names accepted in a Terraform
+// query to host variables
+var terraformAttributes = map[string]string{
+	"ip":   "ansible_host",
+	"node": "proxmox_node",
+	"pool": "proxmox_pool",
+	"type": "proxmox_type",
+	"vmid": "proxmox_vmid",
+}
+
+// ReadTerraformQuery reads the query object Terraform's external data source
+// writes to the program's stdin. An empty input is an empty query.
+func ReadTerraformQuery(r io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	query := map[string]string{}
+	if strings.TrimSpace(string(data)) == "" {
+		return query, nil
+	}
+	if err := json.Unmarshal(data, &query); err != nil {
+		return nil, fmt.Errorf("error reading terraform query: %w", err)
+	}
+	return query, nil
+}
+
+// Terraform renders the inventory as the flat string map expected from a
+// Terraform external data source program, keyed by inventory hostname. The
+// query selects the value of each host and the hosts included:
+//
+//   - "attribute" is "ip" (the default), "vmid", "node", "type", "pool" or
+//     the name of any host variable; list values are joined with ","
+//   - "group" limits the result to the hosts of a group
+//
+// Hosts without a value for the attribute are left out.
+func Terraform(inv *ansible.Inventory, query map[string]string) ([]byte, error) {
+
+	// Resolve the attribute to a host variable
+	attribute := query["attribute"]
+	if attribute == "" {
+		attribute = "ip"
+	}
+	key := attribute
+	if v, ok := terraformAttributes[attribute]; ok {
+		key = v
+	}
+
+	// Select the hosts
+	hosts := inv.HostNames()
+	if name := query["group"]; name != "" {
+		group, ok := inv.Groups[name]
+		if !ok {
+			return nil, fmt.Errorf("group %s not found", name)
+		}
+		hosts = slices.DeleteFunc(hosts, func(host string) bool {
+			return !slices.Contains(group.Hosts, host)
+		})
+	}
+
+	// Build the flat string map
+	result := map[string]string{}
+	for _, host := range hosts {
+		value := hostVarString(inv, host, key)
+		if list := hostVarStrings(inv, host, key); list != nil {
+			value = strings.Join(list, ",")
+		}
+		if value != "" {
+			result[host] = value
+		}
+	}
+
+	str, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(str, '\n'), nil
+}
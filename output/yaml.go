@@ -0,0 +1,56 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+)
+
+// yamlGroup is a group of Ansible's YAML inventory format
+type yamlGroup struct {
+	Hosts    map[string]ansible.HostVars `yaml:"hosts,omitempty"`
+	Vars     ansible.HostVars            `yaml:"vars,omitempty"`
+	Children map[string]yamlGroup        `yaml:"children,omitempty"`
+}
+
+// YAML renders the inventory in Ansible's YAML inventory format, so it can be
+// used as a static inventory file. The host variables are defined under the
+// all group and the other groups only list their hosts.
+func YAML(inv *ansible.Inventory) ([]byte, error) {
+
+	// Define every host with its variables under the all group
+	all := yamlGroup{
+		Hosts:    map[string]ansible.HostVars{},
+		Vars:     inv.All.Vars,
+		Children: map[string]yamlGroup{},
+	}
+	for _, host := range inv.HostNames() {
+		all.Hosts[host] = inv.Meta.HostVars[host]
+	}
+
+	// Add the child groups
+	for name, group := range inv.Groups {
+		child := yamlGroup{Vars: group.Vars}
+		if len(group.Hosts) > 0 {
+			child.Hosts = map[string]ansible.HostVars{}
+			for _, host := range group.Hosts {
+				child.Hosts[host] = nil
+			}
+		}
+		all.Children[name] = child
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]yamlGroup{"all": all}); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
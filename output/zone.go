@@ -0,0 +1,217 @@
+// Package output renders an Ansible inventory in the supported output formats
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+)
+
+var (
+	zoneHashRe   = regexp.MustCompile(`(?m)^; records-hash: ([0-9a-f]+)$`)
+	zoneSerialRe = regexp.MustCompile(`(?m)^\s+(\d+)\s*; serial$`)
+)
+
+// Zone renders the inventory as an RFC 1035 zone file for the domain in
+// proxmox.domain with A and AAAA records for every validly named host in the
+// domain.
+//
+// The SOA serial is deterministic: it starts at zone.serial and is only
+// incremented when the records differ from the previous zone file, which is
+// recognised by the records hash written in its header.
+func Zone(inv *ansible.Inventory, cfg *config.Params, previous []byte) ([]byte, error) {
+
+	origin := strings.Trim(cfg.Proxmox.Domain, ".")
+	if origin == "" {
+		return nil, errors.New("proxmox.domain is required for zone output")
+	}
+
+	// Build the records
+	var records bytes.Buffer
+	for _, host := range inv.HostNames() {
+		name, ok := relativeName(host, origin)
+		if !ok || !ansible.ValidHostName(host) {
+			continue
+		}
+		for _, addr := range hostAddresses(inv, host) {
+			rrType := "A"
+			if addr.Is6() {
+				rrType = "AAAA"
+			}
+			fmt.Fprintf(&records, "%-30s IN %-4s %s\n", name, rrType, addr)
+		}
+	}
+
+	return writeZone(origin, "hostmaster."+origin+".", records.Bytes(), cfg, previous), nil
+}
+
+// ReverseZone renders the inventory as an RFC 1035 zone file for the reverse
+// zone of the network in zone.reverse, e.g. 0.0.10.in-addr.arpa for
+// 10.0.0.0/24, with PTR records for the addresses of every validly named host
+// within the network. The SOA serial works the same way as for Zone.
+func ReverseZone(inv *ansible.Inventory, cfg *config.Params, previous []byte) ([]byte, error) {
+
+	if cfg.Zone.Reverse == "" {
+		return nil, errors.New("zone.reverse is required for reverse-zone output")
+	}
+	prefix, err := netip.ParsePrefix(cfg.Zone.Reverse)
+	if err != nil {
+		return nil, fmt.Errorf("zone.reverse: %w", err)
+	}
+	origin, err := reverseOrigin(prefix)
+	if err != nil {
+		return nil, err
+	}
+	domain := strings.Trim(cfg.Proxmox.Domain, ".")
+
+	// Build the records
+	var records bytes.Buffer
+	for _, host := range inv.HostNames() {
+		if !ansible.ValidHostName(host) {
+			continue
+		}
+		target := host
+		if !strings.Contains(host, ".") {
+			if domain == "" {
+				continue
+			}
+			target += "." + domain
+		}
+		for _, addr := range hostAddresses(inv, host) {
+			if !prefix.Contains(addr) {
+				continue
+			}
+			name := strings.TrimSuffix(reverseName(addr), "."+origin+".")
+			fmt.Fprintf(&records, "%-30s IN PTR %s.\n", name, target)
+		}
+	}
+
+	hostmaster := "hostmaster." + origin + "."
+	if domain != "" {
+		hostmaster = "hostmaster." + domain + "."
+	}
+	return writeZone(origin, hostmaster, records.Bytes(), cfg, previous), nil
+}
+
+// writeZone writes a zone file for origin with the SOA and NS records from
+// the zone section followed by records. The default hostmaster is used unless
+// zone.hostmaster is set.
+func writeZone(origin string, hostmaster string, records []byte, cfg *config.Params, previous []byte) []byte {
+
+	// Determine the serial
+	sum := sha256.Sum256(records)
+	hash := hex.EncodeToString(sum[:8])
+	serial := zoneSerial(cfg.Zone.Serial, previous, hash)
+
+	// Write the zone
+	nameservers := cfg.Zone.Nameservers
+	if len(nameservers) == 0 {
+		nameservers = []string{"localhost."}
+	}
+	if cfg.Zone.Hostmaster != "" {
+		hostmaster = cfg.Zone.Hostmaster
+	}
+	ttl := cfg.Zone.TTL
+	if ttl <= 0 {
+		ttl = 300
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "; Generated by proxmox-ansible-inventory. Do not edit, changes will be overwritten.\n")
+	fmt.Fprintf(&buf, "; records-hash: %s\n", hash)
+	fmt.Fprintf(&buf, "$ORIGIN %s.\n", origin)
+	fmt.Fprintf(&buf, "$TTL %d\n", ttl)
+	fmt.Fprintf(&buf, "@ IN SOA %s %s (\n", nameservers[0], hostmaster)
+	fmt.Fprintf(&buf, "    %d ; serial\n", serial)
+	fmt.Fprintf(&buf, "    3600 ; refresh\n")
+	fmt.Fprintf(&buf, "    600 ; retry\n")
+	fmt.Fprintf(&buf, "    604800 ; expire\n")
+	fmt.Fprintf(&buf, "    %d ; minimum\n", ttl)
+	fmt.Fprintf(&buf, ")\n")
+	for _, ns := range nameservers {
+		fmt.Fprintf(&buf, "@ IN NS %s\n", ns)
+	}
+	fmt.Fprintf(&buf, "\n")
+	buf.Write(records)
+
+	return buf.Bytes()
+}
+
+// zoneSerial returns the SOA serial for records with the given hash. The
+// serial of the previous zone file is kept when its records hash matches and
+// incremented otherwise; without a previous zone file the base serial is used.
+func zoneSerial(base uint32, previous []byte, hash string) uint32 {
+	if base == 0 {
+		base = 1
+	}
+	prevHash := zoneHashRe.FindSubmatch(previous)
+	prevSerial := zoneSerialRe.FindSubmatch(previous)
+	if prevHash == nil || prevSerial == nil {
+		return base
+	}
+	serial, err := strconv.ParseUint(string(prevSerial[1]), 10, 32)
+	if err != nil {
+		return base
+	}
+	if string(prevHash[1]) != hash {
+		serial++
+	}
+	return max(uint32(serial), base)
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of an address
+func reverseName(addr netip.Addr) string {
+	var labels []string
+	if addr.Is4() {
+		b := addr.As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		return strings.Join(labels, ".") + ".in-addr.arpa."
+	}
+	b := addr.As16()
+	for i := len(b) - 1; i >= 0; i-- {
+		labels = append(labels, strconv.FormatUint(uint64(b[i]&0x0f), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa."
+}
+
+// reverseOrigin returns the in-addr.arpa or ip6.arpa zone of a network, which
+// must end on an octet boundary for IPv4 and a nibble boundary for IPv6.
+func reverseOrigin(prefix netip.Prefix) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(reverseName(prefix.Masked().Addr()), "."), ".")
+	var keep int
+	if prefix.Addr().Is4() {
+		if prefix.Bits()%8 != 0 {
+			return "", fmt.Errorf("zone.reverse: %s does not end on an octet boundary", prefix)
+		}
+		keep = prefix.Bits()/8 + 2
+	} else {
+		if prefix.Bits()%4 != 0 {
+			return "", fmt.Errorf("zone.reverse: %s does not end on a nibble boundary", prefix)
+		}
+		keep = prefix.Bits()/4 + 2
+	}
+	return strings.Join(labels[len(labels)-keep:], "."), nil
+}
+
+// relativeName returns host relative to origin, or false if host is not
+// within origin. Single label hosts are considered to be within origin.
+func relativeName(host string, origin string) (string, bool) {
+	if !strings.Contains(host, ".") {
+		return host, true
+	}
+	if origin != "" && strings.HasSuffix(host, "."+origin) {
+		return strings.TrimSuffix(host, "."+origin), true
+	}
+	return "", false
+}
@@ -3,31 +3,69 @@ package proxmox
 
 import "net/http"
 
+// ClusterResources is the response for the Proxmox API cluster resources
+type ClusterResources struct {
+	Data []ClusterResource `json:"data"`
+}
+
+// ClusterResource is the struct for a single Proxmox cluster resource
+type ClusterResource struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"`
+	Node     string  `json:"node"`
+	Vmid     int     `json:"vmid"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Pool     string  `json:"pool"`
+	Tags     string  `json:"tags"`
+	Template int     `json:"template"`
+	Maxcpu   float64 `json:"maxcpu"`
+	Maxmem   int64   `json:"maxmem"`
+	Maxdisk  int64   `json:"maxdisk"`
+	Uptime   int     `json:"uptime"`
+	CPU      float64 `json:"cpu"`
+	Mem      int64   `json:"mem"`
+}
+
 // LxcConfig is the response for the Proxmox API LXC config
 type LxcConfig struct {
 	Data LxcConfigData `json:"data"`
 }
 
-// LxcConfigData is the struct for the Proxmox API LXC config data
+// LxcConfigData is the struct for the Proxmox API LXC config data. The
+// indexed netN and mpN keys are decoded into the Net and Mp maps, keyed by
+// their index.
 type LxcConfigData struct {
-	Swap         int    `json:"swap"`
-	Unprivileged int    `json:"unprivileged"`
-	Net0         string `json:"net0"`
-	Net1         string `json:"net1"`
-	Net2         string `json:"net2"`
-	Net3         string `json:"net3"`
-	Net4         string `json:"net4"`
-	Memory       int    `json:"memory"`
-	Digest       string `json:"digest"`
-	Features     string `json:"features"`
-	Description  string `json:"description"`
-	Tags         string `json:"tags"`
-	Ostype       string `json:"ostype"`
-	Rootfs       string `json:"rootfs"`
-	Cores        int    `json:"cores"`
-	Onboot       int    `json:"onboot"`
-	Hostname     string `json:"hostname"`
-	Arch         string `json:"arch"`
+	Swap         int            `json:"swap"`
+	Unprivileged int            `json:"unprivileged"`
+	Memory       int            `json:"memory"`
+	Digest       string         `json:"digest"`
+	Features     string         `json:"features"`
+	Description  string         `json:"description"`
+	Tags         string         `json:"tags"`
+	Ostype       string         `json:"ostype"`
+	Rootfs       string         `json:"rootfs"`
+	Cores        int            `json:"cores"`
+	Onboot       int            `json:"onboot"`
+	Hostname     string         `json:"hostname"`
+	Arch         string         `json:"arch"`
+	Mp           map[int]string `json:"-"`
+	Net          map[int]string `json:"-"`
+}
+
+// LxcInterfacesResponse is the struct for the Proxmox API response:
+// /api2/json/nodes/pve1/lxc/100/interfaces
+type LxcInterfacesResponse struct {
+	Data []LxcInterface `json:"data"`
+}
+
+// LxcInterface is the struct for a network interface of a running LXC container
+type LxcInterface struct {
+	Name        string                 `json:"name"`
+	Hwaddr      string                 `json:"hwaddr"`
+	Inet        string                 `json:"inet"`
+	Inet6       string                 `json:"inet6"`
+	IPAddresses []QemuAgentIPAddresses `json:"ip-addresses"`
 }
 
 // LxcResponse is the list of Proxmox LXC containers
@@ -114,32 +152,32 @@ type VMConfig struct {
 	Data VMConfigData `json:"data"`
 }
 
-// VMConfigData is the struct for the Proxmox API VM config data
+// VMConfigData is the struct for the Proxmox API VM config data. The
+// indexed ideN, ipconfigN, netN, sataN, scsiN and virtioN keys are decoded
+// into maps keyed by their index.
 type VMConfigData struct {
-	Scsihw  string `json:"scsihw"`
-	Ide2    string `json:"ide2"`
-	Cores   int    `json:"cores"`
-	Vmgenid string `json:"vmgenid"`
-	CPU     string `json:"cpu"`
-	Meta    string `json:"meta"`
-	Scsi1   string `json:"scsi1"`
-	Agent   string `json:"agent"`
-	Digest  string `json:"digest"`
-	Numa    int    `json:"numa"`
-	Memory  string `json:"memory"`
-	Boot    string `json:"boot"`
-	Net0    string `json:"net0"`
-	Net1    string `json:"net1"`
-	Net2    string `json:"net2"`
-	Net3    string `json:"net3"`
-	Net4    string `json:"net4"`
-	Ostype  string `json:"ostype"`
-	Name    string `json:"name"`
-	Tags    string `json:"tags"`
-	Onboot  int    `json:"onboot"`
-	Smbios1 string `json:"smbios1"`
-	Sockets int    `json:"sockets"`
-	Scsi0   string `json:"scsi0"`
+	Scsihw   string         `json:"scsihw"`
+	Cores    int            `json:"cores"`
+	Vmgenid  string         `json:"vmgenid"`
+	CPU      string         `json:"cpu"`
+	Meta     string         `json:"meta"`
+	Agent    string         `json:"agent"`
+	Digest   string         `json:"digest"`
+	Numa     int            `json:"numa"`
+	Memory   string         `json:"memory"`
+	Boot     string         `json:"boot"`
+	Ostype   string         `json:"ostype"`
+	Name     string         `json:"name"`
+	Tags     string         `json:"tags"`
+	Onboot   int            `json:"onboot"`
+	Smbios1  string         `json:"smbios1"`
+	Sockets  int            `json:"sockets"`
+	Ide      map[int]string `json:"-"`
+	Ipconfig map[int]string `json:"-"`
+	Net      map[int]string `json:"-"`
+	Sata     map[int]string `json:"-"`
+	Scsi     map[int]string `json:"-"`
+	Virtio   map[int]string `json:"-"`
 }
 
 // VMList is the struct for the Proxmox API data
@@ -174,6 +212,62 @@ type QemuAgentIPAddresses struct {
 	IPAddressType string `json:"ip-address-type"`
 }
 
+// QemuAgentHostNameResponse is the struct for Qemu API response:
+// /api2/json/nodes/pve1/qemu/100/agent/get-host-name
+type QemuAgentHostNameResponse struct {
+	Data QemuAgentHostNameData `json:"data"`
+}
+
+// QemuAgentHostNameData is the struct for the Proxmox API data
+type QemuAgentHostNameData struct {
+	Result QemuAgentHostName `json:"result"`
+}
+
+// QemuAgentHostName is the host name reported by the QEMU guest agent
+type QemuAgentHostName struct {
+	HostName string `json:"host-name"`
+}
+
+// QemuAgentOSInfoResponse is the struct for Qemu API response:
+// /api2/json/nodes/pve1/qemu/100/agent/get-osinfo
+type QemuAgentOSInfoResponse struct {
+	Data QemuAgentOSInfoData `json:"data"`
+}
+
+// QemuAgentOSInfoData is the struct for the Proxmox API data
+type QemuAgentOSInfoData struct {
+	Result QemuAgentOSInfo `json:"result"`
+}
+
+// QemuAgentOSInfo is the operating system reported by the QEMU guest agent
+type QemuAgentOSInfo struct {
+	ID            string `json:"id"`
+	KernelRelease string `json:"kernel-release"`
+	KernelVersion string `json:"kernel-version"`
+	Machine       string `json:"machine"`
+	Name          string `json:"name"`
+	PrettyName    string `json:"pretty-name"`
+	Version       string `json:"version"`
+	VersionID     string `json:"version-id"`
+}
+
+// QemuAgentTimezoneResponse is the struct for Qemu API response:
+// /api2/json/nodes/pve1/qemu/100/agent/get-timezone
+type QemuAgentTimezoneResponse struct {
+	Data QemuAgentTimezoneData `json:"data"`
+}
+
+// QemuAgentTimezoneData is the struct for the Proxmox API data
+type QemuAgentTimezoneData struct {
+	Result QemuAgentTimezone `json:"result"`
+}
+
+// QemuAgentTimezone is the time zone reported by the QEMU guest agent
+type QemuAgentTimezone struct {
+	Offset int    `json:"offset"`
+	Zone   string `json:"zone"`
+}
+
 // QemuAgentNetworkResult is the struct for the Proxmox API data
 type QemuAgentNetworkResult struct {
 	Name            string                     `json:"name"`
@@ -0,0 +1,305 @@
+// Package proxmox provides a client for the Proxmox API.
+package proxmox
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// qemuNICModels are the network card models of QEMU VMs. A netN property
+// string names the model as the key of the MAC address, e.g. "virtio=BC:24:11:...".
+var qemuNICModels = []string{"e1000", "e1000-82540em", "e1000-82544gc", "e1000-82545em", "e1000e", "i82551", "i82557b",
+	"i82559er", "ne2k_isa", "ne2k_pci", "pcnet", "rtl8139", "virtio", "vmxnet3"}
+
+// diskFormats are the file extensions of QEMU disk images naming their format
+var diskFormats = []string{".qcow2", ".raw", ".vmdk"}
+
+// indexedKeyRe matches an indexed config key such as "net0" or "scsi12"
+var indexedKeyRe = regexp.MustCompile(`^([a-z]+)(\d+)$`)
+
+// NetDevice is a parsed netN property string of a QEMU VM or an LXC container
+type NetDevice struct {
+	// Bridge is the bridge the device is attached to
+	Bridge string
+	// Firewall reports whether the Proxmox firewall is enabled on the device
+	Firewall bool
+	// Gateway is the IPv4 gateway of an LXC interface
+	Gateway string
+	// Gateway6 is the IPv6 gateway of an LXC interface
+	Gateway6 string
+	// IP is the IPv4 setting of an LXC interface, e.g. "10.0.0.5/24" or "dhcp"
+	IP string
+	// IP6 is the IPv6 setting of an LXC interface, e.g. "fd00::5/64", "dhcp" or "auto"
+	IP6 string
+	// MAC is the MAC address in lower case
+	MAC string
+	// Model is the NIC model of a QEMU VM, e.g. "virtio", or the type of an LXC interface, e.g. "veth"
+	Model string
+	// Name is the interface name inside an LXC container, e.g. "eth0"
+	Name string
+	// Tag is the VLAN tag, zero if the device is untagged
+	Tag int
+}
+
+// Disk is a parsed disk property string: a scsiN, virtioN, sataN or ideN
+// disk of a QEMU VM, or the rootfs or an mpN mount point of an LXC container
+type Disk struct {
+	// Backup reports whether the disk is included in backups
+	Backup bool
+	// Discard is the discard setting of a QEMU disk, "on" or "ignore"
+	Discard string
+	// Format is the image format of a QEMU disk, e.g. "raw" or "qcow2", if
+	// set or evident from the volume name
+	Format string
+	// Media is "disk" or "cdrom"
+	Media string
+	// MountPoint is the path of an LXC mount point inside the container
+	MountPoint string
+	// Size is the configured size, e.g. "32G"
+	Size string
+	// SizeBytes is the configured size in bytes
+	SizeBytes int64
+	// SSD reports whether a QEMU disk is presented to the guest as an SSD
+	SSD bool
+	// Storage is the storage the volume is on, empty for bind mounts, passthrough disks and empty drives
+	Storage string
+	// Volume is the volume ID, e.g. "local-lvm:vm-100-disk-0", or the path of a bind mount or device
+	Volume string
+}
+
+// ParseNetDevice parses a netN property string such as
+// "virtio=BC:24:11:00:00:01,bridge=vmbr0,tag=10,firewall=1" for a QEMU VM or
+// "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:02,ip=dhcp,type=veth" for an
+// LXC container.
+func ParseNetDevice(s string) NetDevice {
+	dev := NetDevice{}
+	for _, part := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "bridge":
+			dev.Bridge = value
+		case "firewall":
+			dev.Firewall = value == "1"
+		case "gw":
+			dev.Gateway = value
+		case "gw6":
+			dev.Gateway6 = value
+		case "hwaddr", "macaddr":
+			dev.MAC = strings.ToLower(value)
+		case "ip":
+			dev.IP = value
+		case "ip6":
+			dev.IP6 = value
+		case "model", "type":
+			dev.Model = value
+		case "name":
+			dev.Name = value
+		case "tag":
+			dev.Tag, _ = strconv.Atoi(value)
+		default:
+			if slices.Contains(qemuNICModels, key) {
+				dev.Model = key
+				dev.MAC = strings.ToLower(value)
+			}
+		}
+	}
+	return dev
+}
+
+// ParseDisk parses a QEMU disk or LXC rootfs property string such as
+// "local-lvm:vm-100-disk-0,size=32G,ssd=1". Disks are included in backups
+// unless "backup=0" is set.
+func ParseDisk(s string) Disk {
+	return parseDisk(s, true)
+}
+
+// ParseMountPoint parses an LXC mpN property string such as
+// "ceph:subvol-200-disk-1,mp=/var/lib/postgresql,size=50G". Mount points are
+// only included in backups if "backup=1" is set.
+func ParseMountPoint(s string) Disk {
+	return parseDisk(s, false)
+}
+
+// parseDisk parses a disk property string with the given backup default
+func parseDisk(s string, backup bool) Disk {
+	disk := Disk{Backup: backup, Media: "disk"}
+	for _, part := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			key, value = "volume", key
+		}
+		switch key {
+		case "backup":
+			disk.Backup = value == "1"
+		case "discard":
+			disk.Discard = value
+		case "file", "volume":
+			disk.Volume = value
+		case "format":
+			disk.Format = value
+		case "media":
+			disk.Media = value
+		case "mp":
+			disk.MountPoint = value
+		case "size":
+			disk.Size = value
+			disk.SizeBytes = ParseSize(value)
+		case "ssd":
+			disk.SSD = value == "1"
+		}
+	}
+	if ext := path.Ext(disk.Volume); disk.Format == "" && slices.Contains(diskFormats, ext) {
+		disk.Format = ext[1:]
+	}
+	if storage, _, found := strings.Cut(disk.Volume, ":"); found && !strings.HasPrefix(disk.Volume, "/") {
+		disk.Storage = storage
+	}
+	return disk
+}
+
+// ParseSize converts a Proxmox size such as "32G" or "512M" to bytes. Sizes
+// without a unit are in bytes; invalid sizes return zero.
+func ParseSize(s string) int64 {
+	units := map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+	multiplier := 1.0
+	if len(s) > 0 {
+		if m, ok := units[s[len(s)-1]]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+// Indexes returns the indexes of an indexed config map in ascending order
+func Indexes(m map[int]string) []int {
+	indexes := make([]int, 0, len(m))
+	for i := range m {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for VMConfigData
+func (d *VMConfigData) UnmarshalJSON(data []byte) error {
+
+	type plain VMConfigData
+	if err := json.Unmarshal(data, (*plain)(d)); err != nil {
+		return err
+	}
+
+	indexed, err := indexedKeys(data, "ide", "ipconfig", "net", "sata", "scsi", "virtio")
+	if err != nil {
+		return err
+	}
+	d.Ide = indexed["ide"]
+	d.Ipconfig = indexed["ipconfig"]
+	d.Net = indexed["net"]
+	d.Sata = indexed["sata"]
+	d.Scsi = indexed["scsi"]
+	d.Virtio = indexed["virtio"]
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for VMConfigData
+func (d VMConfigData) MarshalJSON() ([]byte, error) {
+	type plain VMConfigData
+	return marshalIndexed(plain(d), map[string]map[int]string{
+		"ide":      d.Ide,
+		"ipconfig": d.Ipconfig,
+		"net":      d.Net,
+		"sata":     d.Sata,
+		"scsi":     d.Scsi,
+		"virtio":   d.Virtio,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for LxcConfigData
+func (d *LxcConfigData) UnmarshalJSON(data []byte) error {
+
+	type plain LxcConfigData
+	if err := json.Unmarshal(data, (*plain)(d)); err != nil {
+		return err
+	}
+
+	indexed, err := indexedKeys(data, "mp", "net")
+	if err != nil {
+		return err
+	}
+	d.Mp = indexed["mp"]
+	d.Net = indexed["net"]
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for LxcConfigData
+func (d LxcConfigData) MarshalJSON() ([]byte, error) {
+	type plain LxcConfigData
+	return marshalIndexed(plain(d), map[string]map[int]string{
+		"mp":  d.Mp,
+		"net": d.Net,
+	})
+}
+
+// indexedKeys collects the string values of the indexed keys with the given
+// prefixes from a JSON object, e.g. "net0" and "net5" for the prefix "net".
+// Every prefix gets a map, even if the object has none of its keys.
+func indexedKeys(data []byte, prefixes ...string) (map[string]map[int]string, error) {
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	indexed := make(map[string]map[int]string)
+	for _, prefix := range prefixes {
+		indexed[prefix] = make(map[int]string)
+	}
+	for key, value := range raw {
+		m := indexedKeyRe.FindStringSubmatch(key)
+		if m == nil || indexed[m[1]] == nil {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			continue
+		}
+		i, _ := strconv.Atoi(m[2])
+		indexed[m[1]][i] = s
+	}
+
+	return indexed, nil
+}
+
+// marshalIndexed marshals v and adds the indexed keys of the maps to it
+func marshalIndexed(v any, indexed map[string]map[int]string) ([]byte, error) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	for prefix, m := range indexed {
+		for i, value := range m {
+			if raw[prefix+strconv.Itoa(i)], err = json.Marshal(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(raw)
+}
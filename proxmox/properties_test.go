@@ -0,0 +1,253 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want NetDevice
+	}{
+		{
+			name: "qemu virtio",
+			s:    "virtio=BC:24:11:00:00:01,bridge=vmbr0,tag=10,firewall=1",
+			want: NetDevice{Bridge: "vmbr0", Firewall: true, MAC: "bc:24:11:00:00:01", Model: "virtio", Tag: 10},
+		},
+		{
+			name: "qemu e1000 untagged",
+			s:    "e1000=BC:24:11:00:00:05,bridge=vmbr1,firewall=0",
+			want: NetDevice{Bridge: "vmbr1", MAC: "bc:24:11:00:00:05", Model: "e1000"},
+		},
+		{
+			name: "qemu model and macaddr keys",
+			s:    "model=vmxnet3,macaddr=BC:24:11:00:00:06,bridge=vmbr0",
+			want: NetDevice{Bridge: "vmbr0", MAC: "bc:24:11:00:00:06", Model: "vmxnet3"},
+		},
+		{
+			name: "lxc static",
+			s:    "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:02:00,ip=10.0.0.20/24,gw=10.0.0.1,tag=20,firewall=1,type=veth",
+			want: NetDevice{Bridge: "vmbr0", Firewall: true, Gateway: "10.0.0.1", IP: "10.0.0.20/24", MAC: "bc:24:11:00:02:00", Model: "veth", Name: "eth0", Tag: 20},
+		},
+		{
+			name: "lxc dynamic",
+			s:    "name=eth1,bridge=vmbr0,hwaddr=bc:24:11:00:02:01,ip=dhcp,ip6=auto,type=veth",
+			want: NetDevice{Bridge: "vmbr0", IP: "dhcp", IP6: "auto", MAC: "bc:24:11:00:02:01", Model: "veth", Name: "eth1"},
+		},
+		{
+			name: "cloud-init ipconfig",
+			s:    "ip=10.0.1.10/24,gw=10.0.1.1,ip6=fd00::10/64,gw6=fd00::1",
+			want: NetDevice{Gateway: "10.0.1.1", Gateway6: "fd00::1", IP: "10.0.1.10/24", IP6: "fd00::10/64"},
+		},
+		{
+			name: "invalid tag",
+			s:    "virtio=BC:24:11:00:00:01,tag=abc",
+			want: NetDevice{MAC: "bc:24:11:00:00:01", Model: "virtio"},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: NetDevice{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseNetDevice(tt.s); got != tt.want {
+				t.Errorf("ParseNetDevice(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDisk(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		mount bool
+		want  Disk
+	}{
+		{
+			name: "qemu ssd",
+			s:    "local-lvm:vm-100-disk-0,size=32G,ssd=1,discard=on",
+			want: Disk{Backup: true, Discard: "on", Media: "disk", Size: "32G", SizeBytes: 32 << 30, SSD: true, Storage: "local-lvm", Volume: "local-lvm:vm-100-disk-0"},
+		},
+		{
+			name: "qemu no backup",
+			s:    "ceph:vm-100-disk-1,size=100G,backup=0",
+			want: Disk{Media: "disk", Size: "100G", SizeBytes: 100 << 30, Storage: "ceph", Volume: "ceph:vm-100-disk-1"},
+		},
+		{
+			name: "qcow2 inferred",
+			s:    "local:100/vm-100-disk-0.qcow2,size=8G",
+			want: Disk{Backup: true, Format: "qcow2", Media: "disk", Size: "8G", SizeBytes: 8 << 30, Storage: "local", Volume: "local:100/vm-100-disk-0.qcow2"},
+		},
+		{
+			name: "explicit format",
+			s:    "file=nfs:100/vm-100-disk-1.qcow2,format=raw,size=512M",
+			want: Disk{Backup: true, Format: "raw", Media: "disk", Size: "512M", SizeBytes: 512 << 20, Storage: "nfs", Volume: "nfs:100/vm-100-disk-1.qcow2"},
+		},
+		{
+			name: "cdrom",
+			s:    "local:iso/debian-12.iso,media=cdrom,size=628M",
+			want: Disk{Backup: true, Media: "cdrom", Size: "628M", SizeBytes: 628 << 20, Storage: "local", Volume: "local:iso/debian-12.iso"},
+		},
+		{
+			name: "empty cdrom",
+			s:    "none,media=cdrom",
+			want: Disk{Backup: true, Media: "cdrom", Volume: "none"},
+		},
+		{
+			name: "passthrough",
+			s:    "/dev/disk/by-id/ata-SSD_1234,size=500G",
+			want: Disk{Backup: true, Media: "disk", Size: "500G", SizeBytes: 500 << 30, Volume: "/dev/disk/by-id/ata-SSD_1234"},
+		},
+		{
+			name:  "lxc mount point",
+			s:     "ceph:subvol-200-disk-1,mp=/var/lib/postgresql,size=50G",
+			mount: true,
+			want:  Disk{Media: "disk", MountPoint: "/var/lib/postgresql", Size: "50G", SizeBytes: 50 << 30, Storage: "ceph", Volume: "ceph:subvol-200-disk-1"},
+		},
+		{
+			name:  "lxc mount point with backup",
+			s:     "local-zfs:subvol-200-disk-2,mp=/srv,backup=1,size=10G",
+			mount: true,
+			want:  Disk{Backup: true, Media: "disk", MountPoint: "/srv", Size: "10G", SizeBytes: 10 << 30, Storage: "local-zfs", Volume: "local-zfs:subvol-200-disk-2"},
+		},
+		{
+			name:  "lxc bind mount",
+			s:     "/mnt/data,mp=/data",
+			mount: true,
+			want:  Disk{Media: "disk", MountPoint: "/data", Volume: "/mnt/data"},
+		},
+		{
+			name:  "lxc bind mount with colon",
+			s:     "/mnt/a:b,mp=/data",
+			mount: true,
+			want:  Disk{Media: "disk", MountPoint: "/data", Volume: "/mnt/a:b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := ParseDisk
+			if tt.mount {
+				parse = ParseMountPoint
+			}
+			if got := parse(tt.s); got != tt.want {
+				t.Errorf("parse(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"1024", 1024},
+		{"4K", 4 << 10},
+		{"512M", 512 << 20},
+		{"32G", 32 << 30},
+		{"2T", 2 << 40},
+		{"1.5G", 3 << 29},
+		{"", 0},
+		{"G", 0},
+		{"-1G", 0},
+		{"12X", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseSize(tt.s); got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIndexedKeys(t *testing.T) {
+	data := []byte(`{"net0":"a","net12":"b","netx":"c","network0":"d","mp3":"e","net1":5,"scsi0":"f"}`)
+	got, err := indexedKeys(data, "mp", "net", "virtio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[int]string{
+		"mp":     {3: "e"},
+		"net":    {0: "a", 12: "b"},
+		"virtio": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("indexedKeys = %v, want %v", got, want)
+	}
+
+	if _, err := indexedKeys([]byte(`[]`), "net"); err == nil {
+		t.Error("indexedKeys of an array succeeded, want an error")
+	}
+}
+
+func TestVMConfigDataJSON(t *testing.T) {
+	data := []byte(`{"name":"web1","cores":2,"net0":"virtio=BC:24:11:00:00:01,bridge=vmbr0","net12":"e1000=BC:24:11:00:00:0C,bridge=vmbr1",` +
+		`"ipconfig0":"ip=10.0.0.10/24","scsi0":"local-lvm:vm-100-disk-0,size=32G","ide2":"none,media=cdrom","virtio1":"ceph:vm-100-disk-1,size=8G"}`)
+
+	var cfg VMConfigData
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "web1" {
+		t.Errorf("Name = %q, want web1", cfg.Name)
+	}
+	if got, want := Indexes(cfg.Net), []int{0, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Indexes(Net) = %v, want %v", got, want)
+	}
+	if got := ParseNetDevice(cfg.Net[12]).Model; got != "e1000" {
+		t.Errorf("net12 model = %q, want e1000", got)
+	}
+	if cfg.Ipconfig[0] != "ip=10.0.0.10/24" || cfg.Ide[2] != "none,media=cdrom" || cfg.Virtio[1] == "" || len(cfg.Sata) != 0 {
+		t.Errorf("indexed keys = %+v", cfg)
+	}
+
+	// Marshal and unmarshal again without losing the indexed keys or numbers
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw, wantRaw map[string]any
+	if err := json.Unmarshal(out, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &wantRaw); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range wantRaw {
+		if raw[key] != value {
+			t.Errorf("round trip %s = %v, want %v", key, raw[key], value)
+		}
+	}
+	var again VMConfigData
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, cfg) {
+		t.Errorf("round trip = %+v, want %+v", again, cfg)
+	}
+}
+
+func TestLxcConfigDataJSON(t *testing.T) {
+	cfg := LxcConfigData{
+		Hostname: "db1",
+		Rootfs:   "local-lvm:subvol-200-disk-0,size=8G",
+		Mp:       map[int]string{0: "/mnt/data,mp=/data"},
+		Net:      map[int]string{0: "name=eth0,bridge=vmbr0,ip=dhcp", 3: "name=eth3,bridge=vmbr1"},
+	}
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again LxcConfigData
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, cfg) {
+		t.Errorf("round trip = %+v, want %+v", again, cfg)
+	}
+}
@@ -6,46 +6,155 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/leftytennis/proxmox-ansible-inventory/config"
 )
 
+// MaxResponseSize is the largest API response body the client accepts
+const MaxResponseSize = 16 << 20
+
 // ParseLxcIP extracts the IPv4 address from an LXC net config string.
 // The format is like "name=eth0,bridge=vmbr0,ip=10.0.0.5/24,..." — returns
-// the IP without the CIDR prefix, or empty string if not found.
+// the IP without the CIDR prefix, or empty string if not found. Dynamic
+// settings such as "dhcp" or "manual" also return an empty string.
 func ParseLxcIP(netConfig string) string {
-	for _, part := range strings.Split(netConfig, ",") {
-		kv := strings.SplitN(part, "=", 2)
-		if len(kv) == 2 && kv[0] == "ip" {
-			ip := kv[1]
-			if idx := strings.Index(ip, "/"); idx != -1 {
-				ip = ip[:idx]
-			}
-			return ip
-		}
-	}
-	return ""
+	return staticAddress(netProperty(netConfig, "ip"), false)
+}
+
+// ParseLxcIP6 extracts the IPv6 address from an LXC net config string.
+// The format is like "name=eth0,bridge=vmbr0,ip6=fd00::5/64,..." — returns
+// the IP without the CIDR prefix, or empty string if not found. Dynamic
+// settings such as "auto" (SLAAC), "dhcp" or "manual" and link-local
+// addresses also return an empty string.
+func ParseLxcIP6(netConfig string) string {
+	return staticAddress(netProperty(netConfig, "ip6"), true)
+}
+
+// ParseIPConfig extracts the static IPv4 and IPv6 addresses from a cloud-init
+// ipconfigN string such as "ip=10.0.0.5/24,gw=10.0.0.1,ip6=fd00::5/64".
+// Addresses are returned without the CIDR prefix; dynamic settings such as
+// "dhcp" or "auto" return an empty string for that family.
+func ParseIPConfig(ipConfig string) (ipv4 string, ipv6 string) {
+	return staticAddress(netProperty(ipConfig, "ip"), false), staticAddress(netProperty(ipConfig, "ip6"), true)
+}
+
+// IsDynamicLxcNet reports whether an LXC net config string obtains its
+// address at runtime (ip=dhcp, ip6=dhcp or ip6=auto), in which case the
+// address can only be discovered from the running container.
+func IsDynamicLxcNet(netConfig string) bool {
+	ip := netProperty(netConfig, "ip")
+	ip6 := netProperty(netConfig, "ip6")
+	return ip == "dhcp" || ip6 == "dhcp" || ip6 == "auto"
 }
 
 // FindQemuIPv4 returns the first non-loopback IPv4 address from QEMU agent
 // network interface results, or empty string if none found.
 func FindQemuIPv4(results []QemuAgentNetworkResult) string {
+	ipv4, _ := QemuAddresses(results)
+	if len(ipv4) > 0 {
+		return ipv4[0]
+	}
+	return ""
+}
+
+// QemuAddresses returns all usable IPv4 and IPv6 addresses from QEMU agent
+// network interface results. Loopback interfaces and addresses as well as
+// link-local addresses are skipped.
+func QemuAddresses(results []QemuAgentNetworkResult) (ipv4 []string, ipv6 []string) {
 	for _, iface := range results {
 		if iface.Name == "lo" {
 			continue
 		}
-		for _, addr := range iface.IPAddresses {
-			if addr.IPAddressType == "ipv4" {
-				return addr.IPAddress
+		ipv4, ipv6 = appendAgentAddresses(ipv4, ipv6, iface.IPAddresses)
+	}
+	return ipv4, ipv6
+}
+
+// LxcAddresses returns all usable IPv4 and IPv6 addresses from the addresses
+// reported by a running LXC container. Loopback and link-local addresses are
+// skipped.
+func LxcAddresses(ifaces []LxcInterface) (ipv4 []string, ipv6 []string) {
+	for _, iface := range ifaces {
+		if iface.Name == "lo" {
+			continue
+		}
+		if len(iface.IPAddresses) > 0 {
+			ipv4, ipv6 = appendAgentAddresses(ipv4, ipv6, iface.IPAddresses)
+			continue
+		}
+		for _, addr := range strings.Fields(iface.Inet) {
+			if ip := staticAddress(addr, false); ip != "" {
+				ipv4 = append(ipv4, ip)
+			}
+		}
+		for _, addr := range strings.Fields(iface.Inet6) {
+			if ip := staticAddress(addr, true); ip != "" {
+				ipv6 = append(ipv6, ip)
+			}
+		}
+	}
+	return ipv4, ipv6
+}
+
+// appendAgentAddresses appends the usable addresses in addrs to the IPv4 and
+// IPv6 address lists.
+func appendAgentAddresses(ipv4 []string, ipv6 []string, addrs []QemuAgentIPAddresses) ([]string, []string) {
+	for _, addr := range addrs {
+		switch addr.IPAddressType {
+		case "ipv4":
+			if ip := staticAddress(addr.IPAddress, false); ip != "" {
+				ipv4 = append(ipv4, ip)
+			}
+		case "ipv6":
+			if ip := staticAddress(addr.IPAddress, true); ip != "" {
+				ipv6 = append(ipv6, ip)
 			}
 		}
 	}
+	return ipv4, ipv6
+}
+
+// netProperty returns the value of key in a comma separated key=value
+// property string, or empty string if the key is not present.
+func netProperty(netConfig string, key string) string {
+	for _, part := range strings.Split(netConfig, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 && kv[0] == key {
+			return kv[1]
+		}
+	}
 	return ""
 }
 
+// staticAddress strips the CIDR prefix from value and returns the address if
+// it is a usable address of the requested family. Loopback, link-local
+// (169.254.0.0/16 and fe80::/10) and unspecified addresses are rejected, as
+// are non-address values such as "dhcp" or "auto".
+func staticAddress(value string, ipv6 bool) string {
+	if idx := strings.Index(value, "/"); idx != -1 {
+		value = value[:idx]
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return ""
+	}
+	if addr.Is4() == ipv6 || addr.Is4In6() {
+		return ""
+	}
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return ""
+	}
+	return addr.WithZone("").String()
+}
+
 // NewClient creates a new Client
 func NewClient(cfg *config.Params) *Client {
 
@@ -64,10 +173,21 @@ func NewClient(cfg *config.Params) *Client {
 	return &Client{
 		apiToken:   apiToken,
 		BaseURL:    baseURL,
-		HTTPClient: &http.Client{Timeout: time.Second * 30, Transport: transport},
+		HTTPClient: &http.Client{Timeout: cfg.Proxmox.API.Timeout, Transport: transport},
 	}
 }
 
+// StatusError is returned for API responses with a status code other than 2xx
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+}
+
+// Error implements the error interface for StatusError
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
 // doRequest performs the HTTP request
 func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 
@@ -77,289 +197,175 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 	req.Header.Add("Accept", "application/json")
 
 	// Do the request
+	start := time.Now()
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
+		slog.DebugContext(req.Context(), "proxmox request failed", "method", req.Method,
+			"path", req.URL.Path, "duration", time.Since(start), "error", err)
 		return nil, err
 	}
+	slog.DebugContext(req.Context(), "proxmox request", "method", req.Method, "path", req.URL.Path,
+		"status", resp.StatusCode, "duration", time.Since(start),
+		"authorization", RedactAuthorization(req.Header.Get("Authorization")))
 
 	// Check the status code
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		resp.Body.Close()
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// return the response and no error
 	return resp, nil
 }
 
-// GetLxcConfig performs a GET request to the Proxmox API
-func (c *Client) GetLxcConfig(ctx context.Context, node string, vmid int) (*LxcConfig, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/%s/lxc/%d/config", c.BaseURL, node, vmid), nil)
-	if err != nil {
-		return nil, err
+// RedactAuthorization replaces the secret of a PVEAPIToken authorization
+// header with "REDACTED" so the header can be logged safely.
+func RedactAuthorization(value string) string {
+	if tokenID, ok := strings.CutPrefix(value, "PVEAPIToken="); ok {
+		if i := strings.Index(tokenID, "="); i >= 0 {
+			return "PVEAPIToken=" + tokenID[:i+1] + "REDACTED"
+		}
 	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
+	if value != "" {
+		return "REDACTED"
 	}
+	return ""
+}
 
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the LxcConfig struct
-	data := &LxcConfig{}
+// getJSON performs a GET request for the API path made of the escaped path
+// segments and the query parameters, and decodes the response into a T.
+// Errors are wrapped with the method and path of the request.
+func getJSON[T any](ctx context.Context, c *Client, query url.Values, segments ...string) (*T, error) {
 
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
+	// Build the path, escaping every segment
+	path, err := apiPath(segments...)
 	if err != nil {
 		return nil, err
 	}
-
-	// Return the data and no error
-	return data, nil
-}
-
-// GetLxcs performs a GET request to the Proxmox API
-func (c *Client) GetLxcs(ctx context.Context, node string) (*LxcResponse, error) {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
 
 	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/%s/lxc", c.BaseURL, node), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("GET %s: %w", path, err)
 	}
 
-	// Add the context
-	req = req.WithContext(ctx)
-
 	// Do the request
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("GET %s: %w", path, err)
 	}
 
 	// Close the response body
 	defer resp.Body.Close()
 
-	// Create the LxcResponse struct
-	data := &LxcResponse{}
-
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the data and no error
-	return data, nil
-}
-
-// GetNodes performs a GET request to the Proxmox API
-func (c *Client) GetNodes(ctx context.Context) (*NodeList, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/", c.BaseURL), nil)
+	// Read the response, refusing oversized bodies
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("GET %s: %w", path, err)
 	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
+	if len(body) > MaxResponseSize {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", path, MaxResponseSize)
 	}
 
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the NodeList struct
-	data := &NodeList{}
-
 	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
+	data := new(T)
+	if err := json.Unmarshal(body, data); err != nil {
+		return nil, fmt.Errorf("GET %s: decoding response: %w", path, err)
 	}
 
 	// Return the data and no error
 	return data, nil
 }
 
-// GetQemuNetworkConfig performs a GET request to the Proxmox API
-func (c *Client) GetQemuNetworkConfig(ctx context.Context, node string, vmid int) (*QemuAgentNetworkResponse, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/%s/qemu/%d/agent/network-get-interfaces", c.BaseURL, node, vmid), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
+// apiPath joins the path segments of an API request, escaping each of them.
+// Empty segments and the dot segments "." and ".." are rejected, so a path
+// parameter cannot change which endpoint is requested.
+func apiPath(segments ...string) (string, error) {
+	var b strings.Builder
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid path parameter %q", segment)
+		}
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(segment))
 	}
+	return b.String(), nil
+}
 
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the QemuAgentNetworkResponse struct
-	data := &QemuAgentNetworkResponse{}
-
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
+// GetClusterResources performs a GET request to the Proxmox API. The
+// resourceType filters the resources ("vm", "storage", "node" or "sdn"), an
+// empty string returns all of them.
+func (c *Client) GetClusterResources(ctx context.Context, resourceType string) (*ClusterResources, error) {
+	query := url.Values{}
+	if resourceType != "" {
+		query.Set("type", resourceType)
 	}
+	return getJSON[ClusterResources](ctx, c, query, "cluster", "resources")
+}
 
-	// Return the data and no error
-	return data, nil
+// GetLxcConfig performs a GET request to the Proxmox API
+func (c *Client) GetLxcConfig(ctx context.Context, node string, vmid int) (*LxcConfig, error) {
+	return getJSON[LxcConfig](ctx, c, nil, "nodes", node, "lxc", strconv.Itoa(vmid), "config")
 }
 
-// GetSubdirs performs a GET request to the Proxmox API
-func (c *Client) GetSubdirs(ctx context.Context) (*Subdir, error) {
+// GetLxcInterfaces performs a GET request to the Proxmox API
+func (c *Client) GetLxcInterfaces(ctx context.Context, node string, vmid int) (*LxcInterfacesResponse, error) {
+	return getJSON[LxcInterfacesResponse](ctx, c, nil, "nodes", node, "lxc", strconv.Itoa(vmid), "interfaces")
+}
 
-	// Create the request
-	req, err := http.NewRequest("GET", c.BaseURL, nil)
-	if err != nil {
-		return nil, err
-	}
+// GetLxcs performs a GET request to the Proxmox API
+func (c *Client) GetLxcs(ctx context.Context, node string) (*LxcResponse, error) {
+	return getJSON[LxcResponse](ctx, c, nil, "nodes", node, "lxc")
+}
 
-	// Add the context
-	req = req.WithContext(ctx)
+// GetNodes performs a GET request to the Proxmox API
+func (c *Client) GetNodes(ctx context.Context) (*NodeList, error) {
+	return getJSON[NodeList](ctx, c, nil, "nodes")
+}
 
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
-	}
+// GetQemuAgentHostName performs a GET request to the Proxmox API for the
+// hostname reported by the QEMU guest agent
+func (c *Client) GetQemuAgentHostName(ctx context.Context, node string, vmid int) (*QemuAgentHostNameResponse, error) {
+	return getJSON[QemuAgentHostNameResponse](ctx, c, nil, "nodes", node, "qemu", strconv.Itoa(vmid), "agent", "get-host-name")
+}
 
-	// Close the response body
-	defer resp.Body.Close()
+// GetQemuAgentOSInfo performs a GET request to the Proxmox API for the
+// operating system reported by the QEMU guest agent
+func (c *Client) GetQemuAgentOSInfo(ctx context.Context, node string, vmid int) (*QemuAgentOSInfoResponse, error) {
+	return getJSON[QemuAgentOSInfoResponse](ctx, c, nil, "nodes", node, "qemu", strconv.Itoa(vmid), "agent", "get-osinfo")
+}
 
-	// Create the Subdir struct
-	data := &Subdir{}
+// GetQemuAgentTimezone performs a GET request to the Proxmox API for the
+// time zone reported by the QEMU guest agent
+func (c *Client) GetQemuAgentTimezone(ctx context.Context, node string, vmid int) (*QemuAgentTimezoneResponse, error) {
+	return getJSON[QemuAgentTimezoneResponse](ctx, c, nil, "nodes", node, "qemu", strconv.Itoa(vmid), "agent", "get-timezone")
+}
 
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
-	}
+// GetQemuNetworkConfig performs a GET request to the Proxmox API
+func (c *Client) GetQemuNetworkConfig(ctx context.Context, node string, vmid int) (*QemuAgentNetworkResponse, error) {
+	return getJSON[QemuAgentNetworkResponse](ctx, c, nil, "nodes", node, "qemu", strconv.Itoa(vmid), "agent", "network-get-interfaces")
+}
 
-	// Return the data and no error
-	return data, nil
+// GetSubdirs performs a GET request to the Proxmox API
+func (c *Client) GetSubdirs(ctx context.Context) (*Subdir, error) {
+	return getJSON[Subdir](ctx, c, nil)
 }
 
 // GetVersion performs a GET request to the Proxmox API
 func (c *Client) GetVersion(ctx context.Context) (*Version, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/version", c.BaseURL), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the Version struct
-	data := &Version{}
-
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the data and no error
-	return data, nil
+	return getJSON[Version](ctx, c, nil, "version")
 }
 
 // GetVMConfig performs a GET request to the Proxmox API
 func (c *Client) GetVMConfig(ctx context.Context, node string, vmid int) (*VMConfig, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/%s/qemu/%d/config", c.BaseURL, node, vmid), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the VMConfig struct
-	data := &VMConfig{}
-
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the data and no error
-	return data, nil
+	return getJSON[VMConfig](ctx, c, nil, "nodes", node, "qemu", strconv.Itoa(vmid), "config")
 }
 
 // GetVMs performs a GET request to the Proxmox API
 func (c *Client) GetVMs(ctx context.Context, node string) (*VMList, error) {
-
-	// Create the request
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/nodes/%s/qemu", c.BaseURL, node), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add the context
-	req = req.WithContext(ctx)
-
-	// Do the request
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	// Close the response body
-	defer resp.Body.Close()
-
-	// Create the VMList struct
-	data := &VMList{}
-
-	// Decode the response
-	err = json.NewDecoder(resp.Body).Decode(data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the data and no error
-	return data, nil
+	return getJSON[VMList](ctx, c, nil, "nodes", node, "qemu")
 }
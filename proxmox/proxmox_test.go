@@ -0,0 +1,135 @@
+package proxmox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// apiServer is an httptest server recording the escaped request paths and
+// answering every request with body
+type apiServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	paths []string
+}
+
+// newAPIServer starts an apiServer, closed when the test finishes
+func newAPIServer(t *testing.T, body []byte) *apiServer {
+	t.Helper()
+	s := &apiServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.paths = append(s.paths, r.URL.EscapedPath())
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// requests returns the escaped paths requested so far
+func (s *apiServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...)
+}
+
+// newClient returns a client for the server
+func newClient(s *apiServer) *proxmox.Client {
+	cfg := &config.Params{Proxmox: config.ProxmoxParams{API: config.APIParams{
+		Secret: "secret",
+		Token:  "test",
+		URL:    s.URL,
+		User:   "root@pam",
+	}}}
+	return proxmox.NewClient(cfg)
+}
+
+func TestPathEscaping(t *testing.T) {
+	tests := []struct {
+		name string
+		node string
+		want string
+	}{
+		{"plain", "pve1", "/api2/json/nodes/pve1/qemu"},
+		{"slash", "pve1/lxc", "/api2/json/nodes/pve1%2Flxc/qemu"},
+		{"traversal", "../cluster", "/api2/json/nodes/..%2Fcluster/qemu"},
+		{"query", "pve1?type=vm", "/api2/json/nodes/pve1%3Ftype=vm/qemu"},
+		{"space", "pve 1", "/api2/json/nodes/pve%201/qemu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAPIServer(t, []byte(`{"data":[]}`))
+			if _, err := newClient(s).GetVMs(context.Background(), tt.node); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.requests(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("requested %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidPathParameters(t *testing.T) {
+	for _, node := range []string{"", ".", ".."} {
+		t.Run(node, func(t *testing.T) {
+			s := newAPIServer(t, []byte(`{"data":[]}`))
+			_, err := newClient(s).GetVMs(context.Background(), node)
+			if err == nil || !strings.Contains(err.Error(), "invalid path parameter") {
+				t.Errorf("GetVMs(%q) error = %v, want an invalid path parameter", node, err)
+			}
+			if got := s.requests(); len(got) != 0 {
+				t.Errorf("requested %v, want no request", got)
+			}
+		})
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	envelope := func(size int) []byte {
+		body := []byte(`{"data":[],"pad":"`)
+		body = append(body, bytes.Repeat([]byte("x"), size-len(body)-2)...)
+		return append(body, `"}`...)
+	}
+
+	// A body of exactly the limit is accepted
+	s := newAPIServer(t, envelope(proxmox.MaxResponseSize))
+	if _, err := newClient(s).GetNodes(context.Background()); err != nil {
+		t.Errorf("GetNodes with a %d byte body: %v", proxmox.MaxResponseSize, err)
+	}
+
+	// A larger body fails
+	s = newAPIServer(t, envelope(proxmox.MaxResponseSize+1))
+	_, err := newClient(s).GetNodes(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "response larger than") {
+		t.Errorf("GetNodes with a %d byte body error = %v, want response too large", proxmox.MaxResponseSize+1, err)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "PVEAPIToken=root@pam!test=") {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "", 595)
+	}))
+	defer s.Close()
+
+	_, err := newClient(&apiServer{Server: s}).GetNodes(context.Background())
+	var statusErr *proxmox.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 595 {
+		t.Errorf("GetNodes error = %v, want status 595", err)
+	}
+}
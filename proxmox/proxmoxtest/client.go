@@ -0,0 +1,187 @@
+// Package proxmoxtest provides fakes of the Proxmox API for testing code that builds inventories
+package proxmoxtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// Client is an in-memory fake of proxmox.Client that answers from fixtures.
+// Paths without a fixture fail with a proxmox.StatusError for 404.
+type Client struct {
+	// Fixtures are the responses of the fake API
+	Fixtures Fixtures
+	// Latency is added to every call
+	Latency time.Duration
+
+	mu       sync.Mutex
+	errors   map[string]error
+	requests []string
+}
+
+// NewClient creates a Client answering from fixtures
+func NewClient(fixtures Fixtures) *Client {
+	return &Client{Fixtures: fixtures, errors: make(map[string]error)}
+}
+
+// Fail makes every call for path return err, or succeed again if err is nil
+func (c *Client) Fail(path string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.errors, CleanPath(path))
+		return
+	}
+	c.errors[CleanPath(path)] = err
+}
+
+// Requests returns the paths requested so far, in order
+func (c *Client) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+// get decodes the fixture for path into data after the configured latency,
+// or returns the error configured for path.
+func (c *Client) get(ctx context.Context, path string, data any) error {
+
+	path = CleanPath(path)
+	c.mu.Lock()
+	c.requests = append(c.requests, path)
+	err := c.errors[path]
+	body, ok := c.Fixtures[path]
+	c.mu.Unlock()
+
+	// Wait for the latency or the cancellation of the call
+	if c.Latency > 0 {
+		timer := time.NewTimer(c.Latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("GET %s: %w", path, &proxmox.StatusError{StatusCode: http.StatusNotFound})
+	}
+	return json.Unmarshal(body, data)
+}
+
+// GetClusterResources returns the fixture for /cluster/resources. Like the
+// fake server, it ignores the resource type.
+func (c *Client) GetClusterResources(ctx context.Context, resourceType string) (*proxmox.ClusterResources, error) {
+	data := &proxmox.ClusterResources{}
+	if err := c.get(ctx, "/cluster/resources", data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetLxcConfig returns the fixture for /nodes/{node}/lxc/{vmid}/config
+func (c *Client) GetLxcConfig(ctx context.Context, node string, vmid int) (*proxmox.LxcConfig, error) {
+	data := &proxmox.LxcConfig{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/lxc/%d/config", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetLxcInterfaces returns the fixture for /nodes/{node}/lxc/{vmid}/interfaces
+func (c *Client) GetLxcInterfaces(ctx context.Context, node string, vmid int) (*proxmox.LxcInterfacesResponse, error) {
+	data := &proxmox.LxcInterfacesResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/lxc/%d/interfaces", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetLxcs returns the fixture for /nodes/{node}/lxc
+func (c *Client) GetLxcs(ctx context.Context, node string) (*proxmox.LxcResponse, error) {
+	data := &proxmox.LxcResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/lxc", node), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetNodes returns the fixture for /nodes
+func (c *Client) GetNodes(ctx context.Context) (*proxmox.NodeList, error) {
+	data := &proxmox.NodeList{}
+	if err := c.get(ctx, "/nodes", data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetQemuAgentHostName returns the fixture for
+// /nodes/{node}/qemu/{vmid}/agent/get-host-name
+func (c *Client) GetQemuAgentHostName(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentHostNameResponse, error) {
+	data := &proxmox.QemuAgentHostNameResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/agent/get-host-name", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetQemuAgentOSInfo returns the fixture for
+// /nodes/{node}/qemu/{vmid}/agent/get-osinfo
+func (c *Client) GetQemuAgentOSInfo(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentOSInfoResponse, error) {
+	data := &proxmox.QemuAgentOSInfoResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/agent/get-osinfo", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetQemuAgentTimezone returns the fixture for
+// /nodes/{node}/qemu/{vmid}/agent/get-timezone
+func (c *Client) GetQemuAgentTimezone(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentTimezoneResponse, error) {
+	data := &proxmox.QemuAgentTimezoneResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/agent/get-timezone", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetQemuNetworkConfig returns the fixture for
+// /nodes/{node}/qemu/{vmid}/agent/network-get-interfaces
+func (c *Client) GetQemuNetworkConfig(ctx context.Context, node string, vmid int) (*proxmox.QemuAgentNetworkResponse, error) {
+	data := &proxmox.QemuAgentNetworkResponse{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/agent/network-get-interfaces", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetVMConfig returns the fixture for /nodes/{node}/qemu/{vmid}/config
+func (c *Client) GetVMConfig(ctx context.Context, node string, vmid int) (*proxmox.VMConfig, error) {
+	data := &proxmox.VMConfig{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/config", node, vmid), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetVMs returns the fixture for /nodes/{node}/qemu
+func (c *Client) GetVMs(ctx context.Context, node string) (*proxmox.VMList, error) {
+	data := &proxmox.VMList{}
+	if err := c.get(ctx, fmt.Sprintf("/nodes/%s/qemu", node), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
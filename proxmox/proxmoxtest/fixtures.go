@@ -0,0 +1,75 @@
+// Package proxmoxtest provides fakes of the Proxmox API for testing code that builds inventories
+package proxmoxtest
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+)
+
+// Fixtures maps API paths relative to /api2/json, such as "/nodes" or
+// "/nodes/pve1/qemu/100/config", to the JSON response bodies returned for
+// them. Query strings and trailing slashes are not part of the path.
+type Fixtures map[string]json.RawMessage
+
+// CleanPath returns the fixture path of an API request path: the /api2/json
+// prefix, the query string and any trailing slash are removed.
+func CleanPath(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	path = strings.TrimPrefix(path, "/api2/json")
+	path = strings.TrimSuffix(path, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// Set stores data as the response for path, wrapped in the {"data": ...}
+// envelope of the Proxmox API.
+func (f Fixtures) Set(path string, data any) error {
+	body, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		return err
+	}
+	f[CleanPath(path)] = body
+	return nil
+}
+
+// LoadFixtures reads the fixtures in dir. Each file holds the response body
+// of one path, so "nodes/pve1/qemu.json" is served for /nodes/pve1/qemu.
+func LoadFixtures(dir string) (Fixtures, error) {
+
+	f := Fixtures{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f[CleanPath(filepath.ToSlash(strings.TrimSuffix(rel, ".json")))] = body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// FixturePath returns the file in dir holding the fixture for path, the
+// inverse of the naming used by LoadFixtures. It is the file
+// proxmox.RecordTransport records the response for path in, so recordings
+// can be loaded as fixtures.
+func FixturePath(dir string, path string) string {
+	return proxmox.ResponseFile(dir, path)
+}
@@ -0,0 +1,186 @@
+package proxmoxtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox"
+	"github.com/leftytennis/proxmox-ansible-inventory/proxmox/proxmoxtest"
+)
+
+// The assertion lives in a test so proxmoxtest does not import inventory,
+// which lets the inventory package use the fakes in its own tests
+var _ inventory.ProxmoxAPI = (*proxmoxtest.Client)(nil)
+
+func testFixtures(t *testing.T) proxmoxtest.Fixtures {
+	t.Helper()
+	f := proxmoxtest.Fixtures{}
+	if err := f.Set("/nodes", []proxmox.NodeData{{Node: "pve1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("/nodes/pve1/qemu", []proxmox.VM{{Name: "web1", Vmid: 100, Status: "running"}}); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api2/json/nodes/", "/nodes"},
+		{"/api2/json/cluster/resources?type=vm", "/cluster/resources"},
+		{"nodes/pve1/qemu", "/nodes/pve1/qemu"},
+		{"/api2/json", "/"},
+	}
+	for _, tt := range tests {
+		if got := proxmoxtest.CleanPath(tt.path); got != tt.want {
+			t.Errorf("CleanPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	dir := t.TempDir()
+	file := proxmoxtest.FixturePath(dir, "/api2/json/nodes/pve1/qemu")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(`{"data":[{"name":"web1","vmid":100,"status":"running"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a fixture"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := proxmoxtest.LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f) != 1 {
+		t.Fatalf("loaded %d fixtures, want 1", len(f))
+	}
+	vms, err := proxmoxtest.NewClient(f).GetVMs(context.Background(), "pve1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms.Data) != 1 || vms.Data[0].Name != "web1" {
+		t.Errorf("GetVMs = %+v, want web1", vms.Data)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := proxmoxtest.NewClient(testFixtures(t))
+
+	nodes, err := c.GetNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes.Data) != 1 || nodes.Data[0].Node != "pve1" {
+		t.Errorf("GetNodes = %+v, want pve1", nodes.Data)
+	}
+
+	// Paths without a fixture fail like a real cluster
+	var statusErr *proxmox.StatusError
+	if _, err := c.GetLxcs(ctx, "pve1"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetLxcs error = %v, want status 404", err)
+	}
+
+	// Failed paths return the configured error until they are reset
+	errDown := errors.New("node down")
+	c.Fail("/nodes/pve1/qemu", errDown)
+	if _, err := c.GetVMs(ctx, "pve1"); !errors.Is(err, errDown) {
+		t.Errorf("GetVMs error = %v, want %v", err, errDown)
+	}
+	c.Fail("/nodes/pve1/qemu", nil)
+	if _, err := c.GetVMs(ctx, "pve1"); err != nil {
+		t.Errorf("GetVMs after reset: %v", err)
+	}
+
+	want := []string{"/nodes", "/nodes/pve1/lxc", "/nodes/pve1/qemu", "/nodes/pve1/qemu"}
+	if got := c.Requests(); !slices.Equal(got, want) {
+		t.Errorf("Requests = %v, want %v", got, want)
+	}
+
+	// Latency is cut short by the context
+	c.Latency = time.Second
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetNodes(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetNodes with latency error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	srv := proxmoxtest.NewServer(testFixtures(t))
+	defer srv.Close()
+	cfg := srv.Config()
+	if err := cfg.CheckRequiredValues(); err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	c := proxmox.NewClient(cfg)
+
+	if _, err := c.GetNodes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fixtures can be replaced while the server runs
+	if err := srv.SetFixture("/nodes/pve1/lxc", []proxmox.LxcData{{Name: "db1", Vmid: 200, Status: "running"}}); err != nil {
+		t.Fatal(err)
+	}
+	lxcs, err := c.GetLxcs(ctx, "pve1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lxcs.Data) != 1 || lxcs.Data[0].Name != "db1" {
+		t.Errorf("GetLxcs = %+v, want db1", lxcs.Data)
+	}
+
+	// Failed paths respond with the configured status
+	var statusErr *proxmox.StatusError
+	srv.Fail("/nodes/pve1/qemu", 595)
+	if _, err := c.GetVMs(ctx, "pve1"); !errors.As(err, &statusErr) || statusErr.StatusCode != 595 {
+		t.Errorf("GetVMs error = %v, want status 595", err)
+	}
+	srv.Fail("/nodes/pve1/qemu", 0)
+	if _, err := c.GetVMs(ctx, "pve1"); err != nil {
+		t.Errorf("GetVMs after reset: %v", err)
+	}
+
+	// Delayed paths time out
+	srv.Delay("/nodes", time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetNodes(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetNodes with delay error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	want := []string{"/nodes", "/nodes/pve1/lxc", "/nodes/pve1/qemu", "/nodes/pve1/qemu", "/nodes"}
+	if got := srv.Requests(); !slices.Equal(got, want) {
+		t.Errorf("Requests = %v, want %v", got, want)
+	}
+}
+
+func TestServerUnauthorized(t *testing.T) {
+	srv := proxmoxtest.NewServer(testFixtures(t))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api2/json/nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
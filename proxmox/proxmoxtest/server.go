@@ -0,0 +1,137 @@
+// Package proxmoxtest provides fakes of the Proxmox API for testing code that builds inventories
+package proxmoxtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/spf13/viper"
+)
+
+// Server is a fake Proxmox API server answering from fixtures under
+// /api2/json. Requests without a PVEAPIToken authorization get 401 and
+// paths without a fixture get 404, so a proxmox.Client pointed at the server
+// sees the same errors as against a real cluster.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fixtures Fixtures
+	failures map[string]int
+	latency  map[string]time.Duration
+	requests []string
+}
+
+// NewServer starts a Server answering from fixtures. The caller should call
+// Close when finished, to shut it down.
+func NewServer(fixtures Fixtures) *Server {
+	s := &Server{
+		fixtures: fixtures,
+		failures: make(map[string]int),
+		latency:  make(map[string]time.Duration),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns a configuration with the defaults of config.SetDefaults
+// whose proxmox.api section points at the server.
+func (s *Server) Config() *config.Params {
+
+	// Unmarshal the defaults the same way as the config file
+	v := viper.New()
+	config.SetDefaults(v)
+	cfg := &config.Params{}
+	if err := v.Unmarshal(cfg); err != nil {
+		panic(err) // the defaults always match the config types
+	}
+
+	cfg.Proxmox.API = config.APIParams{
+		Secret:  "00000000-0000-0000-0000-000000000000",
+		Timeout: 5 * time.Second,
+		Token:   "test",
+		URL:     s.URL,
+		User:    "root@pam",
+	}
+	return cfg
+}
+
+// SetFixture replaces the fixture for path, see Fixtures.Set
+func (s *Server) SetFixture(path string, data any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fixtures.Set(path, data)
+}
+
+// Fail makes requests for path respond with status, or succeed again if
+// status is 0. Proxmox uses 595 for nodes it cannot reach.
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.failures, CleanPath(path))
+		return
+	}
+	s.failures[CleanPath(path)] = status
+}
+
+// Delay makes requests for path wait d before responding. The path "*"
+// delays every request.
+func (s *Server) Delay(path string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if path != "*" {
+		path = CleanPath(path)
+	}
+	s.latency[path] = d
+}
+
+// Requests returns the paths requested so far, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// handle serves a single API request
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+
+	path := CleanPath(r.URL.Path)
+	s.mu.Lock()
+	s.requests = append(s.requests, path)
+	status := s.failures[path]
+	body, ok := s.fixtures[path]
+	delay := s.latency["*"] + s.latency[path]
+	s.mu.Unlock()
+
+	// Simulate a slow node, giving up when the client does
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, `{"data":null}`, http.StatusMethodNotAllowed)
+	case !strings.HasPrefix(r.Header.Get("Authorization"), "PVEAPIToken="):
+		http.Error(w, `{"data":null}`, http.StatusUnauthorized)
+	case !strings.HasPrefix(r.URL.Path, "/api2/json/"):
+		http.NotFound(w, r)
+	case status != 0:
+		http.Error(w, `{"data":null}`, status)
+	case !ok:
+		http.Error(w, `{"data":null}`, http.StatusNotFound)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
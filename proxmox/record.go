@@ -0,0 +1,181 @@
+// Package proxmox provides a client for the Proxmox API.
+package proxmox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// secretKeys are substrings of the JSON keys whose values are scrubbed from
+// recorded responses, matched case-insensitively.
+var secretKeys = []string{"password", "secret", "ticket", "token"}
+
+// ResponseFile returns the file in dir a response for the API path is
+// recorded in: everything up to /api2/json and the query string are dropped,
+// so the response for /api2/json/nodes/pve1/qemu is nodes/pve1/qemu.json.
+func ResponseFile(dir string, path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if _, rest, ok := strings.Cut(path, "/api2/json"); ok {
+		path = rest
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		path = "index"
+	}
+	return filepath.Join(dir, filepath.FromSlash(path)+".json")
+}
+
+// ScrubResponse replaces the values of secret looking keys, such as
+// cipassword, in a JSON response body with "REDACTED" and indents it.
+func ScrubResponse(body []byte) ([]byte, error) {
+	var data any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(scrub(data), "", "   ")
+}
+
+// scrub walks a decoded JSON value and redacts the values of secret keys
+func scrub(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSecretKey(key) {
+				v[key] = "REDACTED"
+				continue
+			}
+			v[key] = scrub(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = scrub(value)
+		}
+	}
+	return v
+}
+
+// isSecretKey reports whether a JSON key names a secret
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordTransport is an http.RoundTripper that saves every response of the
+// Proxmox API under Dir, with secrets scrubbed, so it can be replayed with
+// ReplayTransport. Successful responses are saved as the JSON body, other
+// responses as their status code in a .status file next to it.
+type RecordTransport struct {
+	// Dir is the directory the responses are saved in
+	Dir string
+	// Transport performs the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface for RecordTransport
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	// Do the request
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the body so it can be saved and still be returned
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Save the response
+	if err := t.save(req.URL.Path, resp.StatusCode, body); err != nil {
+		return nil, fmt.Errorf("error recording %s: %w", req.URL.Path, err)
+	}
+
+	return resp, nil
+}
+
+// save writes a response to the file for path, or its status code to the
+// .status file next to it if the request failed.
+func (t *RecordTransport) save(path string, statusCode int, body []byte) error {
+
+	file := ResponseFile(t.Dir, path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	// Replace an earlier recording of the other outcome
+	status := strings.TrimSuffix(file, ".json") + ".status"
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		os.Remove(file)
+		return os.WriteFile(status, []byte(strconv.Itoa(statusCode)+"\n"), 0644)
+	}
+	os.Remove(status)
+
+	scrubbed, err := ScrubResponse(body)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(scrubbed, '\n'), 0644)
+}
+
+// ReplayTransport is an http.RoundTripper that answers Proxmox API requests
+// from the responses saved by RecordTransport in Dir, without any network
+// access. Requests that were not recorded get 404 Not Found.
+type ReplayTransport struct {
+	// Dir is the directory the responses were saved in
+	Dir string
+}
+
+// RoundTrip implements the http.RoundTripper interface for ReplayTransport
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	// Answer with the recorded status code or body
+	file := ResponseFile(t.Dir, req.URL.Path)
+	status := http.StatusOK
+	body, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		status = http.StatusNotFound
+		body = []byte(`{"data":null}`)
+		if s, err := os.ReadFile(strings.TrimSuffix(file, ".json") + ".status"); err == nil {
+			if code, err := strconv.Atoi(strings.TrimSpace(string(s))); err == nil {
+				status = code
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+)
+
+// reportColumns are the columns available in the report
+var reportColumns = []string{"name", "vmid", "node", "type", "status", "cpus", "maxmem", "maxdisk", "uptime", "tags", "ip"}
+
+// reportRow is a single guest of the report
+type reportRow struct {
+	g    *inventory.Guest
+	vars ansible.HostVars
+}
+
+// runReport prints a table, CSV or Markdown listing of the guests in the
+// inventory. The guests are selected by the inventory's filter rules and
+// optionally limited to the hosts of --group.
+func runReport(ctx context.Context, b *inventory.Builder, w io.Writer) error {
+
+	// Check the columns and sort order
+	for _, column := range columnsFlag {
+		if !slices.Contains(reportColumns, column) {
+			return fmt.Errorf("unknown column %q (must be one of %s)", column, strings.Join(reportColumns, ", "))
+		}
+	}
+	sortColumn := strings.TrimPrefix(sortFlag, "-")
+	if !slices.Contains(reportColumns, sortColumn) {
+		return fmt.Errorf("unknown sort column %q (must be one of %s)", sortColumn, strings.Join(reportColumns, ", "))
+	}
+
+	// Discover the guests
+	inv, guests, err := b.Discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Select the rows
+	rows := []reportRow{}
+	for _, g := range guests {
+		if groupFlag != "" && !slices.Contains(inv.Groups[groupFlag].Hosts, g.Hostname) {
+			continue
+		}
+		rows = append(rows, reportRow{g: g, vars: inv.Meta.HostVars[g.Hostname]})
+	}
+
+	// Sort the rows
+	slices.SortStableFunc(rows, func(a, b reportRow) int {
+		c := compareColumn(sortColumn, a, b)
+		if strings.HasPrefix(sortFlag, "-") {
+			return -c
+		}
+		return c
+	})
+
+	// Print the report
+	switch reportFormatFlag {
+	case "table":
+		return writeTable(w, rows)
+	case "csv":
+		return writeCSV(w, rows)
+	case "markdown":
+		return writeMarkdown(w, rows)
+	default:
+		return fmt.Errorf("unknown report format %q (must be table, csv or markdown)", reportFormatFlag)
+	}
+}
+
+// compareColumn compares two rows by a column, numerically for numeric columns
+func compareColumn(column string, a reportRow, b reportRow) int {
+	switch column {
+	case "vmid":
+		return cmp.Compare(a.g.Vmid, b.g.Vmid)
+	case "cpus":
+		return cmp.Compare(a.g.CPUs, b.g.CPUs)
+	case "maxmem":
+		return cmp.Compare(a.g.Maxmem, b.g.Maxmem)
+	case "maxdisk":
+		return cmp.Compare(a.g.Maxdisk, b.g.Maxdisk)
+	case "uptime":
+		return cmp.Compare(a.g.Uptime, b.g.Uptime)
+	default:
+		return cmp.Compare(a.value(column, false), b.value(column, false))
+	}
+}
+
+// value returns the value of a column. Human readable values format sizes
+// and durations for display, otherwise bytes and seconds are used.
+func (r reportRow) value(column string, human bool) string {
+	switch column {
+	case "name":
+		return r.g.Hostname
+	case "vmid":
+		return strconv.Itoa(r.g.Vmid)
+	case "node":
+		return r.g.Node
+	case "type":
+		return r.g.Type
+	case "status":
+		return r.g.Status
+	case "cpus":
+		return strconv.Itoa(r.g.CPUs)
+	case "maxmem":
+		if human {
+			return formatBytes(r.g.Maxmem)
+		}
+		return strconv.FormatInt(r.g.Maxmem, 10)
+	case "maxdisk":
+		if human {
+			return formatBytes(r.g.Maxdisk)
+		}
+		return strconv.FormatInt(r.g.Maxdisk, 10)
+	case "uptime":
+		if human {
+			return (time.Duration(r.g.Uptime) * time.Second).String()
+		}
+		return strconv.Itoa(r.g.Uptime)
+	case "tags":
+		return strings.Join(r.g.Tags, ";")
+	case "ip":
+		ip, _ := r.vars["ansible_host"].(string)
+		return ip
+	}
+	return ""
+}
+
+// writeTable writes the rows as an aligned text table
+func writeTable(w io.Writer, rows []reportRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columnsFlag, "\t")))
+	for _, r := range rows {
+		values := []string{}
+		for _, column := range columnsFlag {
+			values = append(values, r.value(column, true))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeCSV writes the rows as CSV with a header row, using bytes and seconds
+// for sizes and durations
+func writeCSV(w io.Writer, rows []reportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columnsFlag); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		values := []string{}
+		for _, column := range columnsFlag {
+			values = append(values, r.value(column, false))
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeMarkdown writes the rows as a Markdown table
+func writeMarkdown(w io.Writer, rows []reportRow) error {
+	separators := []string{}
+	for range columnsFlag {
+		separators = append(separators, "---")
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(columnsFlag, " | "))
+	fmt.Fprintf(w, "| %s |\n", strings.Join(separators, " | "))
+	for _, r := range rows {
+		values := []string{}
+		for _, column := range columnsFlag {
+			values = append(values, strings.ReplaceAll(r.value(column, true), "|", `\|`))
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(values, " | "))
+	}
+	return nil
+}
+
+// formatBytes formats a size in bytes with a binary unit, e.g. "2.0 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/output"
+	"github.com/leftytennis/proxmox-ansible-inventory/webhook"
+)
+
+// inventoryServer serves the most recently built inventory over HTTP
+type inventoryServer struct {
+	mu       sync.RWMutex
+	inv      *ansible.Inventory
+	updated  time.Time
+	err      error
+	notifier *webhook.Notifier
+
+	// baseline is the last complete inventory, webhooks report the changes
+	// relative to it. It is only used by refresh.
+	baseline *ansible.Inventory
+}
+
+// serve runs the HTTP server until ctx is cancelled by SIGINT or SIGTERM, refreshing
+// the inventory from Proxmox every refreshFlag interval in the background.
+func serve(ctx context.Context, b *inventory.Builder) error {
+
+	if refreshFlag <= 0 {
+		return fmt.Errorf("--refresh must be positive, got %s", refreshFlag)
+	}
+
+	// Build the initial inventory before accepting requests
+	s := &inventoryServer{notifier: webhook.NewNotifier(Config.Webhooks)}
+	s.refresh(ctx, b)
+
+	srv := &http.Server{
+		Addr:              listenFlag,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Refresh the inventory in the background
+	go func() {
+		ticker := time.NewTicker(refreshFlag)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refresh(ctx, b)
+			}
+		}
+	}()
+
+	// Shutdown gracefully once a signal is received
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	slog.Info("serving inventory", "listen", listenFlag)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// refresh rebuilds the inventory and sends the changes to the webhooks. A
+// failed refresh keeps serving the previous inventory and is reported by
+// /healthz.
+func (s *inventoryServer) refresh(ctx context.Context, b *inventory.Builder) {
+	inv, err := b.Build(ctx)
+	s.mu.Lock()
+	s.err = err
+	if err == nil {
+		s.inv = inv
+		s.updated = time.Now()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		slog.Error("error refreshing inventory", "error", err)
+		return
+	}
+	s.baseline = notifyChanges(ctx, s.notifier, s.baseline, inv)
+}
+
+// notifyChanges sends the changes from baseline to inv to the webhooks and
+// returns the baseline for the next build. Inventories missing whole nodes
+// are not compared and leave the baseline as is, as the guests of those
+// nodes would be reported as removed and then added again.
+func notifyChanges(ctx context.Context, notifier *webhook.Notifier, baseline *ansible.Inventory, inv *ansible.Inventory) *ansible.Inventory {
+	if nodes := inv.MissingNodes(); len(nodes) > 0 {
+		slog.Warn("not sending webhooks for an inventory missing nodes", "nodes", nodes)
+		return baseline
+	}
+	if baseline != nil {
+		if err := notifier.Notify(ctx, ansible.Diff(baseline, inv)); err != nil {
+			slog.Error("error sending webhooks", "error", err)
+		}
+	}
+	return inv
+}
+
+// current returns the most recently built inventory, or nil if none has been
+// built yet.
+func (s *inventoryServer) current() *ansible.Inventory {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.inv
+}
+
+// routes returns the handler for the server endpoints
+func (s *inventoryServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /inventory", s.withInventory(s.handleInventory))
+	mux.HandleFunc("GET /hosts/{name}", s.withInventory(s.handleHost))
+	mux.HandleFunc("GET /groups/{name}", s.withInventory(s.handleGroup))
+	mux.HandleFunc("GET /prometheus/targets", s.withInventory(s.handlePrometheus))
+	return mux
+}
+
+// withInventory responds with 503 Service Unavailable until the first
+// inventory has been built.
+func (s *inventoryServer) withInventory(h func(http.ResponseWriter, *http.Request, *ansible.Inventory)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inv := s.current()
+		if inv == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "inventory not available yet")
+			return
+		}
+		h(w, r, inv)
+	}
+}
+
+// handleHealth reports when the inventory was last refreshed, the error of
+// the last refresh and the nodes or guests left out of the inventory, if any.
+func (s *inventoryServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := http.StatusOK
+	health := map[string]any{"status": "ok"}
+	if !s.updated.IsZero() {
+		health["updated"] = s.updated.UTC().Format(time.RFC3339)
+	}
+	if s.inv != nil && s.inv.Degraded() {
+		health["status"] = "degraded"
+		health["diagnostics"] = s.inv.Meta.Diagnostics
+	}
+	if s.err != nil {
+		health["status"] = "degraded"
+		health["error"] = s.err.Error()
+	}
+	if s.inv == nil {
+		status = http.StatusServiceUnavailable
+		health["status"] = "unavailable"
+	}
+	body, _ := json.Marshal(health)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// handleInventory serves the full inventory in the --list format
+func (s *inventoryServer) handleInventory(w http.ResponseWriter, r *http.Request, inv *ansible.Inventory) {
+	writeJSON(w, r, inv)
+}
+
+// handleHost serves the variables of a single host in the --host format
+func (s *inventoryServer) handleHost(w http.ResponseWriter, r *http.Request, inv *ansible.Inventory) {
+	name := r.PathValue("name")
+	if !slices.Contains(inv.HostNames(), name) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("host %s not found", name))
+		return
+	}
+	vars := inv.Meta.HostVars[name]
+	if vars == nil {
+		vars = ansible.HostVars{}
+	}
+	writeJSON(w, r, vars)
+}
+
+// handleGroup serves a single group
+func (s *inventoryServer) handleGroup(w http.ResponseWriter, r *http.Request, inv *ansible.Inventory) {
+	name := r.PathValue("name")
+	group, ok := inv.Groups[name]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("group %s not found", name))
+		return
+	}
+	writeJSON(w, r, group)
+}
+
+// handlePrometheus serves the Prometheus http_sd target groups
+func (s *inventoryServer) handlePrometheus(w http.ResponseWriter, r *http.Request, inv *ansible.Inventory) {
+	writeJSON(w, r, output.TargetGroups(inv, &Config))
+}
+
+// writeJSON writes v as JSON with an ETag derived from the body, responding
+// with 304 Not Modified when the request's If-None-Match matches it.
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison required for If-None-Match.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONError writes an error response as {"error": msg}
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+	"github.com/leftytennis/proxmox-ansible-inventory/inventory"
+	"github.com/leftytennis/proxmox-ansible-inventory/output"
+	"github.com/leftytennis/proxmox-ansible-inventory/webhook"
+)
+
+// watch polls the cluster resources every watch.interval and rebuilds the
+// inventory when guests, their state or their tags change, or at least every
+// watch.rebuild_interval to pick up changed addresses. The configured output
+// files are rewritten atomically when their content changes, after which the
+// hook is run. It returns when ctx is cancelled by SIGINT or SIGTERM.
+func watch(ctx context.Context, b *inventory.Builder) error {
+
+	// Use --format and --output when no outputs are configured
+	outputs := Config.Watch.Outputs
+	if len(outputs) == 0 && outputFlag != "" {
+		outputs = []config.OutputParams{{Format: formatFlag, Path: outputFlag}}
+	}
+	if len(outputs) == 0 {
+		return errors.New("watch requires watch.outputs or --output")
+	}
+	for _, out := range outputs {
+		if !slices.Contains(output.Formats, out.Format) {
+			return fmt.Errorf("watch.outputs: unknown output format %q for %s", out.Format, out.Path)
+		}
+	}
+
+	if Config.Watch.Interval <= 0 {
+		return fmt.Errorf("watch.interval must be positive, got %s", Config.Watch.Interval)
+	}
+	if Config.Watch.RebuildInterval <= 0 {
+		return fmt.Errorf("watch.rebuild_interval must be positive, got %s", Config.Watch.RebuildInterval)
+	}
+
+	ticker := time.NewTicker(Config.Watch.Interval)
+	defer ticker.Stop()
+
+	notifier := webhook.NewNotifier(Config.Webhooks)
+
+	var fingerprint []byte
+	var lastBuild time.Time
+	var baseline *ansible.Inventory
+	for {
+		// Check whether the guests changed
+		current, err := clusterFingerprint(ctx, b)
+		if err != nil {
+			slog.Error("error polling cluster resources", "error", err)
+		} else if !bytes.Equal(current, fingerprint) || time.Since(lastBuild) >= Config.Watch.RebuildInterval {
+			inv, err := regenerate(ctx, b, outputs)
+			if err != nil {
+				slog.Error("error regenerating outputs", "error", err)
+			} else {
+				fingerprint = current
+				lastBuild = time.Now()
+				baseline = notifyChanges(ctx, notifier, baseline, inv)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// clusterFingerprint returns a hash of the guests in the cluster resources
+// list covering their identity, node, state, tags and pool.
+func clusterFingerprint(ctx context.Context, b *inventory.Builder) ([]byte, error) {
+
+	resources, err := b.API.GetClusterResources(ctx, "vm")
+	if err != nil {
+		return nil, err
+	}
+
+	guests := []string{}
+	for _, r := range resources.Data {
+		guests = append(guests, fmt.Sprintf("%d %s %s %s %s %s %s", r.Vmid, r.Type, r.Node, r.Name, r.Status, r.Tags, r.Pool))
+	}
+	sort.Strings(guests)
+
+	sum := sha256.Sum256([]byte(strings.Join(guests, "\n")))
+	return sum[:], nil
+}
+
+// regenerate rebuilds the inventory, rewrites the outputs whose content
+// changed and runs the hook if any of them did. It returns the new inventory.
+func regenerate(ctx context.Context, b *inventory.Builder, outputs []config.OutputParams) (*ansible.Inventory, error) {
+
+	inv, err := b.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for _, out := range outputs {
+		previous, _ := os.ReadFile(out.Path)
+		str, err := output.Render(out.Format, inv, &Config, previous)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering %s: %w", out.Path, err)
+		}
+		if bytes.Equal(str, previous) {
+			continue
+		}
+		if err := output.WriteFile(out.Path, str); err != nil {
+			return nil, err
+		}
+		changed = append(changed, out.Path)
+	}
+
+	if len(changed) == 0 || Config.Watch.Hook == "" {
+		return inv, nil
+	}
+	return inv, runHook(ctx, Config.Watch.Hook, changed)
+}
+
+// runHook runs the hook command through the shell with the changed output
+// files in the PAI_CHANGED_FILES environment variable, separated by the
+// path list separator.
+func runHook(ctx context.Context, hook string, changed []string) error {
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook)
+	}
+	cmd.Env = append(os.Environ(), "PAI_CHANGED_FILES="+strings.Join(changed, string(os.PathListSeparator)))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %w", hook, err)
+	}
+	return nil
+}
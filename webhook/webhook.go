@@ -0,0 +1,177 @@
+// Package webhook sends notifications about inventory changes to HTTP endpoints
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/leftytennis/proxmox-ansible-inventory/ansible"
+	"github.com/leftytennis/proxmox-ansible-inventory/config"
+)
+
+// SignatureHeader is the header carrying the HMAC-SHA256 signature of the
+// payload as "sha256=<hex>" when a webhook secret is configured
+const SignatureHeader = "X-Signature-256"
+
+// Payload is the body of a generic JSON webhook
+type Payload struct {
+	Event        string                `json:"event"`
+	Timestamp    string                `json:"timestamp"`
+	AddedHosts   []ansible.HostGroups  `json:"added_hosts"`
+	RemovedHosts []ansible.HostGroups  `json:"removed_hosts"`
+	GroupChanges []ansible.GroupChange `json:"group_changes"`
+}
+
+// Notifier sends inventory changes to the configured webhooks
+type Notifier struct {
+	HTTPClient *http.Client
+	hooks      []config.WebhookParams
+}
+
+// NewNotifier creates a new Notifier for the configured webhooks
+func NewNotifier(hooks []config.WebhookParams) *Notifier {
+	return &Notifier{
+		HTTPClient: &http.Client{Timeout: time.Second * 10},
+		hooks:      hooks,
+	}
+}
+
+// Notify sends the diff to every webhook when hosts were added, removed or
+// changed groups. Host variable changes alone do not trigger a notification.
+// Every webhook is tried even if an earlier one fails; the returned error
+// joins the errors of all failed webhooks.
+func (n *Notifier) Notify(ctx context.Context, d *ansible.InventoryDiff) error {
+
+	if len(d.AddedHosts) == 0 && len(d.RemovedHosts) == 0 && len(d.GroupChanges) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, hook := range n.hooks {
+		body, err := payload(hook.Type, d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", hook.URL, err))
+			continue
+		}
+		if err := n.send(ctx, hook, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", hook.URL, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// send posts the body to a webhook, retrying failed attempts with an
+// exponential backoff starting at one second.
+func (n *Notifier) send(ctx context.Context, hook config.WebhookParams, body []byte) error {
+
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = n.post(ctx, hook, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// post performs a single webhook request and reports whether a failure is
+// worth retrying: network errors, 429 Too Many Requests and 5xx responses.
+func (n *Notifier) post(ctx context.Context, hook config.WebhookParams, body []byte) (bool, error) {
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	// Do the request
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	// Check the status code
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retry, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// Sign returns the "sha256=<hex>" HMAC-SHA256 signature of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// payload builds the request body for the webhook type: "json" (the default)
+// sends a Payload, "slack" sends a Slack compatible {"text": ...} message.
+func payload(hookType string, d *ansible.InventoryDiff) ([]byte, error) {
+	switch hookType {
+	case "", "json":
+		return json.Marshal(Payload{
+			Event:        "inventory_changed",
+			Timestamp:    time.Now().UTC().Format(time.RFC3339),
+			AddedHosts:   d.AddedHosts,
+			RemovedHosts: d.RemovedHosts,
+			GroupChanges: d.GroupChanges,
+		})
+	case "slack":
+		return json.Marshal(map[string]string{"text": slackText(d)})
+	default:
+		return nil, fmt.Errorf("unknown webhook type %q", hookType)
+	}
+}
+
+// slackText formats the membership changes of a diff as a Slack message
+func slackText(d *ansible.InventoryDiff) string {
+	var b strings.Builder
+	b.WriteString("*Proxmox inventory changed*\n")
+	for _, h := range d.AddedHosts {
+		fmt.Fprintf(&b, ":heavy_plus_sign: `%s` (%s)\n", h.Host, strings.Join(h.Groups, ", "))
+	}
+	for _, h := range d.RemovedHosts {
+		fmt.Fprintf(&b, ":heavy_minus_sign: `%s` (%s)\n", h.Host, strings.Join(h.Groups, ", "))
+	}
+	for _, c := range d.GroupChanges {
+		changes := []string{}
+		for _, group := range c.Added {
+			changes = append(changes, "+"+group)
+		}
+		for _, group := range c.Removed {
+			changes = append(changes, "-"+group)
+		}
+		fmt.Fprintf(&b, ":arrows_counterclockwise: `%s` groups: %s\n", c.Host, strings.Join(changes, " "))
+	}
+	return b.String()
+}